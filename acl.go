@@ -0,0 +1,322 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Right is a mailbox access right of the ACL extension (RFC 4314).
+type Right byte
+
+const (
+	RightLookup         Right = 'l' // see the mailbox in LIST
+	RightRead           Right = 'r' // SELECT, FETCH, SEARCH, COPY from
+	RightSeen           Right = 's' // keep \Seen
+	RightWrite          Right = 'w' // set flags other than \Seen and \Deleted
+	RightInsert         Right = 'i' // APPEND and COPY into
+	RightPost           Right = 'p' // send mail to the submission address
+	RightCreate         Right = 'k' // create child mailboxes
+	RightDelete         Right = 'x' // delete or rename the mailbox
+	RightDeleteMessages Right = 't' // set \Deleted
+	RightExpunge        Right = 'e' // EXPUNGE
+	RightAdmin          Right = 'a' // administer the ACL
+)
+
+// rightsOrder is the order rights are listed in, as RFC 4314 does.
+const rightsOrder = "lrswipkxtea"
+
+// Rights is a set of rights.
+type Rights map[Right]struct{}
+
+// NewRights returns a set of the given rights.
+func NewRights(rights ...Right) Rights {
+	r := make(Rights, len(rights))
+	r.Add(rights...)
+	return r
+}
+
+// ParseRights returns the set of the rights in s, as in "lrswi".
+func ParseRights(s string) Rights {
+	r := make(Rights, len(s))
+	for i := 0; i < len(s); i++ {
+		r[Right(s[i])] = struct{}{}
+	}
+	return r
+}
+
+// Has reports whether right is in the set.
+func (r Rights) Has(right Right) bool {
+	_, ok := r[right]
+	return ok
+}
+
+// Add adds rights to the set.  It panics on a nil set; use NewRights.
+func (r Rights) Add(rights ...Right) {
+	for _, right := range rights {
+		r[right] = struct{}{}
+	}
+}
+
+// Remove removes rights from the set.
+func (r Rights) Remove(rights ...Right) {
+	for _, right := range rights {
+		delete(r, right)
+	}
+}
+
+// String formats the set as in "lrswi": the standard rights in the
+// RFC's order, then any others, such as digits, in byte order.
+func (r Rights) String() string {
+	var b strings.Builder
+	for i := 0; i < len(rightsOrder); i++ {
+		if r.Has(Right(rightsOrder[i])) {
+			b.WriteByte(rightsOrder[i])
+		}
+	}
+	for c := 0; c < 256; c++ {
+		if r.Has(Right(c)) && strings.IndexByte(rightsOrder, byte(c)) < 0 {
+			b.WriteByte(byte(c))
+		}
+	}
+	return b.String()
+}
+
+// ResponseACL is an ACL response: the rights of each identifier, such
+// as a user name, "anyone", or with "-" in front, rights denied.
+type ResponseACL struct {
+	Mailbox string
+	Rights  map[string]Rights
+}
+
+// ResponseListRights is a LISTRIGHTS response: the rights identifier
+// always has on the mailbox, and those that may be granted to it,
+// each group granted or not as one.
+type ResponseListRights struct {
+	Mailbox, Identifier string
+	Required            Rights
+	Optional            []Rights
+}
+
+// ResponseMyRights is a MYRIGHTS response: the user's rights on the
+// mailbox.
+type ResponseMyRights struct {
+	Mailbox string
+	Rights  Rights
+}
+
+// readAStrings reads space-separated astrings up to the end of the
+// line.
+func (r *reader) readAStrings() []string {
+	var strs []string
+	for {
+		s, err := r.readAString()
+		check(err)
+		strs = append(strs, s)
+		c, err := r.ReadByte()
+		check(err)
+		if c != ' ' {
+			check(r.UnreadByte())
+			break
+		}
+	}
+	check(r.expectEOL())
+	return strs
+}
+
+func (r *reader) readACL() *ResponseACL {
+	// mailbox *(SP identifier SP rights)
+	strs := r.readAStrings()
+	if len(strs)%2 != 1 {
+		panic(fmt.Errorf("bad ACL response %q", strs))
+	}
+	acl := &ResponseACL{Mailbox: strs[0], Rights: make(map[string]Rights)}
+	for i := 1; i < len(strs); i += 2 {
+		acl.Rights[strs[i]] = ParseRights(strs[i+1])
+	}
+	return acl
+}
+
+func (r *reader) readLISTRIGHTS() *ResponseListRights {
+	// mailbox SP identifier SP rights *(SP rights)
+	strs := r.readAStrings()
+	if len(strs) < 3 {
+		panic(fmt.Errorf("bad LISTRIGHTS response %q", strs))
+	}
+	list := &ResponseListRights{Mailbox: strs[0], Identifier: strs[1], Required: ParseRights(strs[2])}
+	for _, s := range strs[3:] {
+		list.Optional = append(list.Optional, ParseRights(s))
+	}
+	return list
+}
+
+func (r *reader) readMYRIGHTS() *ResponseMyRights {
+	// mailbox SP rights
+	strs := r.readAStrings()
+	if len(strs) != 2 {
+		panic(fmt.Errorf("bad MYRIGHTS response %q", strs))
+	}
+	return &ResponseMyRights{Mailbox: strs[0], Rights: ParseRights(strs[1])}
+}
+
+// ACLChange says how SetACL changes an identifier's rights.
+type ACLChange string
+
+const (
+	ACLReplace ACLChange = ""
+	ACLAdd     ACLChange = "+"
+	ACLRemove  ACLChange = "-"
+)
+
+// GetACL returns the access control list of a mailbox.
+func (imap *IMAP) GetACL(mailbox string) (*ResponseACL, error) {
+	return imap.GetACLContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) GetACLContext(ctx context.Context, mailbox string) (*ResponseACL, error) {
+	c, err := imap.GetACLAsyncContext(ctx, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	r, err := imap.aclResult(ctx, c, mailbox, func(r interface{}) bool {
+		acl, ok := r.(*ResponseACL)
+		return ok && acl.Mailbox == mailbox
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*ResponseACL), nil
+}
+
+func (imap *IMAP) GetACLAsync(mailbox string) (*Command, error) {
+	return imap.GetACLAsyncContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) GetACLAsyncContext(ctx context.Context, mailbox string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "GETACL %s", quote(mailbox))
+}
+
+// SetACL changes the rights of identifier on a mailbox: replaces
+// them, or adds or removes some, as change says.
+func (imap *IMAP) SetACL(mailbox, identifier string, change ACLChange, rights Rights) error {
+	return imap.SetACLContext(context.Background(), mailbox, identifier, change, rights)
+}
+
+func (imap *IMAP) SetACLContext(ctx context.Context, mailbox, identifier string, change ACLChange, rights Rights) error {
+	c, err := imap.SetACLAsyncContext(ctx, mailbox, identifier, change, rights)
+	if err != nil {
+		return err
+	}
+	_, err = imap.aclResult(ctx, c, mailbox, nil)
+	return err
+}
+
+func (imap *IMAP) SetACLAsync(mailbox, identifier string, change ACLChange, rights Rights) (*Command, error) {
+	return imap.SetACLAsyncContext(context.Background(), mailbox, identifier, change, rights)
+}
+
+func (imap *IMAP) SetACLAsyncContext(ctx context.Context, mailbox, identifier string, change ACLChange, rights Rights) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "SETACL %s %s %s", quote(mailbox), quote(identifier), quote(string(change)+rights.String()))
+}
+
+// DeleteACL removes identifier from the access control list of a
+// mailbox.
+func (imap *IMAP) DeleteACL(mailbox, identifier string) error {
+	return imap.DeleteACLContext(context.Background(), mailbox, identifier)
+}
+
+func (imap *IMAP) DeleteACLContext(ctx context.Context, mailbox, identifier string) error {
+	c, err := imap.DeleteACLAsyncContext(ctx, mailbox, identifier)
+	if err != nil {
+		return err
+	}
+	_, err = imap.aclResult(ctx, c, mailbox, nil)
+	return err
+}
+
+func (imap *IMAP) DeleteACLAsync(mailbox, identifier string) (*Command, error) {
+	return imap.DeleteACLAsyncContext(context.Background(), mailbox, identifier)
+}
+
+func (imap *IMAP) DeleteACLAsyncContext(ctx context.Context, mailbox, identifier string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "DELETEACL %s %s", quote(mailbox), quote(identifier))
+}
+
+// ListRights returns the rights that identifier may be granted on a
+// mailbox.
+func (imap *IMAP) ListRights(mailbox, identifier string) (*ResponseListRights, error) {
+	return imap.ListRightsContext(context.Background(), mailbox, identifier)
+}
+
+func (imap *IMAP) ListRightsContext(ctx context.Context, mailbox, identifier string) (*ResponseListRights, error) {
+	c, err := imap.ListRightsAsyncContext(ctx, mailbox, identifier)
+	if err != nil {
+		return nil, err
+	}
+	r, err := imap.aclResult(ctx, c, mailbox, func(r interface{}) bool {
+		list, ok := r.(*ResponseListRights)
+		return ok && list.Mailbox == mailbox && list.Identifier == identifier
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*ResponseListRights), nil
+}
+
+func (imap *IMAP) ListRightsAsync(mailbox, identifier string) (*Command, error) {
+	return imap.ListRightsAsyncContext(context.Background(), mailbox, identifier)
+}
+
+func (imap *IMAP) ListRightsAsyncContext(ctx context.Context, mailbox, identifier string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "LISTRIGHTS %s %s", quote(mailbox), quote(identifier))
+}
+
+// MyRights returns the user's rights on a mailbox.
+func (imap *IMAP) MyRights(mailbox string) (Rights, error) {
+	return imap.MyRightsContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) MyRightsContext(ctx context.Context, mailbox string) (Rights, error) {
+	c, err := imap.MyRightsAsyncContext(ctx, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	r, err := imap.aclResult(ctx, c, mailbox, func(r interface{}) bool {
+		my, ok := r.(*ResponseMyRights)
+		return ok && my.Mailbox == mailbox
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.(*ResponseMyRights).Rights, nil
+}
+
+func (imap *IMAP) MyRightsAsync(mailbox string) (*Command, error) {
+	return imap.MyRightsAsyncContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) MyRightsAsyncContext(ctx context.Context, mailbox string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "MYRIGHTS %s", quote(mailbox))
+}
+
+// aclResult waits for an ACL command on mailbox and returns the
+// response that wanted picks out, if wanted isn't nil; the others are
+// unsolicited.
+func (imap *IMAP) aclResult(ctx context.Context, c *Command, mailbox string, wanted func(interface{}) bool) (interface{}, error) {
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var found interface{}
+	for _, extra := range resp.Extra {
+		if wanted != nil && found == nil && wanted(extra) {
+			found = extra
+		} else {
+			imap.unsolicited(extra)
+		}
+	}
+	if wanted != nil && found == nil {
+		return nil, fmt.Errorf("imap: no %s response for %q", c.cmd.name, mailbox)
+	}
+	return found, nil
+}
@@ -0,0 +1,120 @@
+package imap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRights(t *testing.T) {
+	r := ParseRights("aeilr9")
+	if !r.Has(RightAdmin) || !r.Has(RightLookup) || r.Has(RightWrite) {
+		t.Errorf("ParseRights: got %v", r)
+	}
+	r.Add(RightWrite, RightSeen)
+	r.Remove(RightAdmin)
+	if got, want := r.String(), "lrswie9"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	if got := NewRights().String(); got != "" {
+		t.Errorf("empty String: got %q", got)
+	}
+}
+
+func TestACL(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	var acl *ResponseACL
+	done := async(func() (err error) {
+		acl, err = imap.GetACL("INBOX")
+		return err
+	})
+	srv.expect(`a0 GETACL "INBOX"`)
+	srv.send(`* ACL INBOX Fred rwipslxetad "-anyone" r`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetACL: %s", err)
+	}
+	want := &ResponseACL{Mailbox: "INBOX", Rights: map[string]Rights{
+		"Fred":    ParseRights("lrswipxtead"),
+		"-anyone": NewRights(RightRead),
+	}}
+	if !reflect.DeepEqual(acl, want) {
+		t.Errorf("got %#v, want %#v", acl, want)
+	}
+
+	done = async(func() error {
+		return imap.SetACL("INBOX", "Fred", ACLAdd, NewRights(RightCreate, RightLookup))
+	})
+	srv.expect(`a1 SETACL "INBOX" "Fred" "+lk"`)
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("SetACL: %s", err)
+	}
+
+	done = async(func() error {
+		return imap.SetACL("INBOX", "anyone", ACLReplace, NewRights())
+	})
+	srv.expect(`a2 SETACL "INBOX" "anyone" ""`)
+	srv.send("a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("SetACL: %s", err)
+	}
+
+	done = async(func() error {
+		return imap.DeleteACL("INBOX", "Fred")
+	})
+	srv.expect(`a3 DELETEACL "INBOX" "Fred"`)
+	srv.send("a3 NO [NOPERM] not allowed")
+	var imapErr *IMAPError
+	if err := wait(t, done); !errors.As(err, &imapErr) || imapErr.Status != NO {
+		t.Errorf("DeleteACL: got %v, want NO", err)
+	}
+}
+
+func TestListRights(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	var list *ResponseListRights
+	done := async(func() (err error) {
+		list, err = imap.ListRights("~/Mail/saved", "smith")
+		return err
+	})
+	srv.expect(`a0 LISTRIGHTS "~/Mail/saved" "smith"`)
+	srv.send(`* LISTRIGHTS ~/Mail/saved smith la r swicdkxte`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("ListRights: %s", err)
+	}
+	want := &ResponseListRights{
+		Mailbox:    "~/Mail/saved",
+		Identifier: "smith",
+		Required:   ParseRights("la"),
+		Optional:   []Rights{ParseRights("r"), ParseRights("swicdkxte")},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("got %#v, want %#v", list, want)
+	}
+
+	var rights Rights
+	done = async(func() (err error) {
+		rights, err = imap.MyRights("INBOX")
+		return err
+	})
+	srv.expect(`a1 MYRIGHTS "INBOX"`)
+	srv.send(`* MYRIGHTS "INBOX" rwiptsldaex`, "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("MyRights: %s", err)
+	}
+	if got, want := rights.String(), "lrswipxtead"; got != want {
+		t.Errorf("MyRights: got %q, want %q", got, want)
+	}
+
+	done = async(func() (err error) {
+		_, err = imap.MyRights("Sent")
+		return err
+	})
+	srv.expect(`a2 MYRIGHTS "Sent"`)
+	srv.send("a2 OK done")
+	if err := wait(t, done); err == nil {
+		t.Errorf("MyRights without a response: no error")
+	}
+}
@@ -0,0 +1,112 @@
+package imap
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// capCache holds what the server said of its capabilities: the list
+// from the greeting, a CAPABILITY code or response, and the
+// extensions turned on with ENABLE.
+type capCache struct {
+	mu sync.Mutex
+	// caps is nil when the capabilities aren't known, as after
+	// logging in until the server says.
+	caps    []string
+	enabled []string
+}
+
+func (c *capCache) set(caps []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caps = append([]string{}, caps...)
+}
+
+func (c *capCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caps = nil
+}
+
+func (c *capCache) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.caps == nil {
+		return nil
+	}
+	return append([]string{}, c.caps...)
+}
+
+func (c *capCache) enable(caps []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cap := range caps {
+		if !hasCapability(c.enabled, cap) {
+			c.enabled = append(c.enabled, cap)
+		}
+	}
+}
+
+func (c *capCache) isEnabled(cap string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return hasCapability(c.enabled, cap)
+}
+
+// learn records the capabilities in a response or response code, if
+// it has any.
+func (imap *IMAP) learn(r interface{}) {
+	switch r := r.(type) {
+	case *ResponseCapabilities:
+		imap.caps.set(r.Capabilities)
+	case *ResponseEnabled:
+		imap.caps.enable(r.Capabilities)
+	}
+}
+
+// Capabilities returns the server's capabilities as last announced,
+// or nil if they aren't known.  They are announced in the greeting,
+// usually, and after logging in, and asked for by Capability.
+func (imap *IMAP) Capabilities() []string {
+	return imap.caps.get()
+}
+
+// Has reports whether the server announced the capability, as in
+// Has("IDLE") or Has("AUTH=PLAIN"), or has it as part of IMAP4rev2.
+// It doesn't ask the server; if the capabilities aren't known, it
+// returns false.
+func (imap *IMAP) Has(cap string) bool {
+	return hasCap(imap.caps.get(), cap)
+}
+
+// hasCap is hasCapability with the extensions IMAP4rev2 implies.
+func hasCap(caps []string, cap string) bool {
+	if hasCapability(caps, cap) {
+		return true
+	}
+	return hasCapability(caps, string(IMAP4rev2)) && hasCapability(rev2Implied, cap)
+}
+
+// hasCapability reports whether name is in caps, ignoring case.
+func hasCapability(caps []string, name string) bool {
+	for _, c := range caps {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// supports is Has, asking the server if the capabilities aren't
+// known.
+func (imap *IMAP) supports(ctx context.Context, cap string) (bool, error) {
+	caps := imap.caps.get()
+	if caps == nil {
+		var err error
+		if caps, err = imap.CapabilityContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	return hasCap(caps, cap), nil
+}
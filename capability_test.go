@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCapabilityCache(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 STARTTLS AUTH=PLAIN LOGINDISABLED] ready")
+	if !imap.Has("auth=plain") || imap.Has("IDLE") {
+		t.Errorf("Has: capabilities are %v", imap.Capabilities())
+	}
+
+	// Logging in forgets them, until the server says anew.
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	srv.expect("a0 LOGIN joe secret")
+	if caps := imap.Capabilities(); caps != nil {
+		t.Errorf("capabilities %v after LOGIN, want none", caps)
+	}
+	srv.send("a0 OK [CAPABILITY IMAP4rev1 IDLE ENABLE] Logged in")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+	if got, want := imap.Capabilities(), []string{"IMAP4rev1", "IDLE", "ENABLE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Capabilities() = %v, want %v", got, want)
+	}
+
+	// Unsolicited updates are picked up too.
+	srv.send("* CAPABILITY IMAP4rev1 IDLE ENABLE CONDSTORE")
+	deadline := time.Now().Add(5 * time.Second)
+	for !imap.Has("CONDSTORE") {
+		if time.Now().After(deadline) {
+			t.Fatalf("capabilities %v", imap.Capabilities())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var enabled []string
+	done = async(func() (err error) {
+		enabled, err = imap.Enable("CONDSTORE", "UTF8=ACCEPT")
+		return err
+	})
+	srv.expect("a1 ENABLE CONDSTORE UTF8=ACCEPT")
+	srv.send("* ENABLED CONDSTORE", "a1 OK enabled")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Enable: %s", err)
+	}
+	if want := []string{"CONDSTORE"}; !reflect.DeepEqual(enabled, want) {
+		t.Errorf("Enable() = %v, want %v", enabled, want)
+	}
+	if !imap.Enabled("condstore") || imap.Enabled("UTF8=ACCEPT") {
+		t.Errorf("Enabled wrong")
+	}
+}
+
+func TestPreauthCapabilities(t *testing.T) {
+	imap, _ := newTestClient(t, "* PREAUTH [CAPABILITY IMAP4rev1 IDLE] Logged in as joe")
+	if !imap.Has("IDLE") {
+		t.Errorf("capabilities %v", imap.Capabilities())
+	}
+}
@@ -0,0 +1,249 @@
+package imap
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Legacy charsets, as found in the headers of mail written before
+// UTF-8 caught on: the single-byte ISO-8859-x and Windows-125x, GBK
+// (which GB2312 mail is read as, GBK being its superset) and
+// ISO-2022-JP.  UTF-8, US-ASCII and ISO-8859-1 are left to
+// mime.WordDecoder, which knows them itself.  A sequence the charset
+// leaves undefined decodes as U+FFFD.  The tables, in
+// charset_tables.go, follow the WHATWG Encoding Standard's indexes.
+
+// charsetReader decodes input from charset, for mime.WordDecoder.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	decode, err := lookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	var in strings.Builder
+	if _, err := io.Copy(&in, input); err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decode(in.String())), nil
+}
+
+// lookupCharset returns the decoder of charset.  It knows the usual
+// aliases, such as "latin2", "cp1251" and "x-gbk".
+func lookupCharset(charset string) (func(string) string, error) {
+	name := strings.ToLower(strings.TrimSpace(charset))
+	name = strings.Replace(name, "_", "-", -1)
+	if alias, ok := charsetAliases[name]; ok {
+		name = alias
+	}
+	switch {
+	case strings.HasPrefix(name, "iso8859-"):
+		name = "iso-" + name[3:]
+	case strings.HasPrefix(name, "x-cp125"):
+		name = "windows-" + name[4:]
+	case strings.HasPrefix(name, "cp125"):
+		name = "windows-" + name[2:]
+	}
+	switch name {
+	case "us-ascii", "iso-8859-1":
+		return decodeSingleByte(nil), nil
+	case "gbk":
+		return decodeGBK, nil
+	case "iso-2022-jp":
+		return decodeISO2022JP, nil
+	}
+	if table, ok := charsets[name]; ok {
+		return decodeSingleByte(table), nil
+	}
+	return nil, fmt.Errorf("unknown charset %q", charset)
+}
+
+var charsetAliases = map[string]string{
+	"ascii":       "us-ascii",
+	"latin1":      "iso-8859-1",
+	"l1":          "iso-8859-1",
+	"latin2":      "iso-8859-2",
+	"l2":          "iso-8859-2",
+	"latin3":      "iso-8859-3",
+	"l3":          "iso-8859-3",
+	"latin4":      "iso-8859-4",
+	"l4":          "iso-8859-4",
+	"cyrillic":    "iso-8859-5",
+	"arabic":      "iso-8859-6",
+	"greek":       "iso-8859-7",
+	"hebrew":      "iso-8859-8",
+	"latin5":      "iso-8859-9",
+	"l5":          "iso-8859-9",
+	"latin6":      "iso-8859-10",
+	"l6":          "iso-8859-10",
+	"latin7":      "iso-8859-13",
+	"latin8":      "iso-8859-14",
+	"latin9":      "iso-8859-15",
+	"latin10":     "iso-8859-16",
+	"gb2312":      "gbk",
+	"gb-2312-80":  "gbk",
+	"csgb2312":    "gbk",
+	"euc-cn":      "gbk",
+	"x-gbk":       "gbk",
+	"cp936":       "gbk",
+	"csiso2022jp": "iso-2022-jp",
+}
+
+var charsets = map[string]*[128]uint16{
+	"iso-8859-2":   &iso8859_2,
+	"iso-8859-3":   &iso8859_3,
+	"iso-8859-4":   &iso8859_4,
+	"iso-8859-5":   &iso8859_5,
+	"iso-8859-6":   &iso8859_6,
+	"iso-8859-7":   &iso8859_7,
+	"iso-8859-8":   &iso8859_8,
+	"iso-8859-9":   &iso8859_9,
+	"iso-8859-10":  &iso8859_10,
+	"iso-8859-13":  &iso8859_13,
+	"iso-8859-14":  &iso8859_14,
+	"iso-8859-15":  &iso8859_15,
+	"iso-8859-16":  &iso8859_16,
+	"windows-1250": &windows1250,
+	"windows-1251": &windows1251,
+	"windows-1252": &windows1252,
+	"windows-1253": &windows1253,
+	"windows-1254": &windows1254,
+	"windows-1255": &windows1255,
+	"windows-1256": &windows1256,
+	"windows-1257": &windows1257,
+	"windows-1258": &windows1258,
+}
+
+// lookup returns table[i] as a rune, or U+FFFD if it's out of range
+// or undefined.
+func lookup(table []uint16, i int) rune {
+	if i < 0 || i >= len(table) || table[i] == 0 {
+		return utf8.RuneError
+	}
+	return rune(table[i])
+}
+
+// decodeSingleByte returns the decoder of a charset whose bytes 0x80
+// to 0xFF are in table, the lower half being ASCII; a nil table is
+// ISO-8859-1, whose bytes are their own code points.
+func decodeSingleByte(table *[128]uint16) func(string) string {
+	return func(s string) string {
+		var out strings.Builder
+		for i := 0; i < len(s); i++ {
+			r := rune(s[i])
+			if r >= 0x80 && table != nil {
+				r = lookup(table[:], int(r-0x80))
+			}
+			out.WriteRune(r)
+		}
+		return out.String()
+	}
+}
+
+// decodeGBK decodes GBK: ASCII, the euro sign as 0x80, and two-byte
+// characters of a lead byte 0x81-0xFE and a trail byte 0x40-0xFE
+// other than 0x7F.  GB18030's four-byte sequences aren't decoded.
+func decodeGBK(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c0 := s[i]
+		switch {
+		case c0 < 0x80:
+			out.WriteByte(c0)
+		case c0 == 0x80:
+			out.WriteRune('€')
+		case c0 == 0xFF || i+1 == len(s):
+			out.WriteRune(utf8.RuneError)
+		default:
+			c1 := int(s[i+1])
+			switch {
+			case 0x40 <= c1 && c1 < 0x7F:
+				c1 -= 0x40
+			case 0x80 <= c1 && c1 < 0xFF:
+				c1 -= 0x41
+			default:
+				// Not a trail byte; leave it to be read
+				// afresh.
+				out.WriteRune(utf8.RuneError)
+				continue
+			}
+			out.WriteRune(lookup(gbkDecode[:], int(c0-0x81)*190+c1))
+			i++
+		}
+	}
+	return out.String()
+}
+
+// decodeISO2022JP decodes ISO-2022-JP (RFC 1468), as extended to
+// half-width katakana by the WHATWG: escape sequences switch between
+// ASCII, JIS X 0201 Roman and katakana, and two-byte JIS X 0208.
+func decodeISO2022JP(s string) string {
+	const (
+		ascii = iota
+		roman
+		katakana
+		jis0208
+	)
+	state := ascii
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == 0x1B && i+2 < len(s) {
+			next := ascii
+			switch s[i+1 : i+3] {
+			case "(B":
+				next = ascii
+			case "(J":
+				next = roman
+			case "(I":
+				next = katakana
+			case "$@", "$B":
+				next = jis0208
+			default:
+				out.WriteRune(utf8.RuneError)
+				continue
+			}
+			state = next
+			i += 2
+			continue
+		}
+		switch {
+		case c >= 0x80 || c == 0x1B:
+			out.WriteRune(utf8.RuneError)
+		case c == '\r' || c == '\n':
+			// A line break ends any multibyte run.
+			state = ascii
+			out.WriteByte(c)
+		case state == ascii:
+			out.WriteByte(c)
+		case state == roman:
+			switch c {
+			case '\\':
+				out.WriteRune('¥')
+			case '~':
+				out.WriteRune('‾')
+			default:
+				out.WriteByte(c)
+			}
+		case state == katakana:
+			if c < 0x21 || c > 0x5F {
+				out.WriteRune(utf8.RuneError)
+			} else {
+				out.WriteRune(rune(c) - 0x21 + 0xFF61)
+			}
+		default:
+			if c < 0x21 || c > 0x7E || i+1 == len(s) {
+				out.WriteRune(utf8.RuneError)
+				continue
+			}
+			c1 := s[i+1]
+			if c1 < 0x21 || c1 > 0x7E {
+				out.WriteRune(utf8.RuneError)
+				continue
+			}
+			out.WriteRune(lookup(jis0208Decode[:], int(c-0x21)*94+int(c1-0x21)))
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,142 @@
+package imap
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer is the server end of a connection to a client under test,
+// driven line by line from the test.
+type testServer struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newTestClient connects a client to a scripted server that sends
+// greeting, and starts it.
+func newTestClient(t *testing.T, greeting string) (*IMAP, *testServer) {
+	imap, srv := newTestConn(t)
+	go srv.send(greeting)
+	if _, err := imap.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	return imap, srv
+}
+
+func newTestConn(t *testing.T) (*IMAP, *testServer) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	srv := &testServer{t, server, bufio.NewReader(server)}
+	return New(client, client), srv
+}
+
+// expect reads a command line from the client and checks it.
+func (s *testServer) expect(line string) {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := s.r.ReadString('\n')
+	if err != nil {
+		s.t.Fatalf("expecting %q: %s", line, err)
+	}
+	if got = strings.TrimRight(got, "\r\n"); got != line {
+		s.t.Fatalf("expected %q, got %q", line, got)
+	}
+}
+
+// send writes response lines to the client.
+func (s *testServer) send(lines ...string) {
+	for _, line := range lines {
+		if _, err := s.conn.Write([]byte(line + "\r\n")); err != nil {
+			return
+		}
+	}
+}
+
+// async runs f in the background and returns its error on a channel.
+func async(f func() error) chan error {
+	ch := make(chan error, 1)
+	go func() { ch <- f() }()
+	return ch
+}
+
+func wait(t *testing.T, ch chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for command")
+	}
+	return nil
+}
+
+func TestPreauthGreeting(t *testing.T) {
+	imap, _ := newTestClient(t, "* PREAUTH [CAPABILITY IMAP4rev1] Logged in as joe")
+	if state := imap.State(); state != StateAuthenticated {
+		t.Fatalf("state = %s, want %s", state, StateAuthenticated)
+	}
+}
+
+func TestByeGreeting(t *testing.T) {
+	imap, srv := newTestConn(t)
+	go srv.send("* BYE too many connections")
+	_, err := imap.Start()
+	bye, ok := err.(*ErrServerBye)
+	if !ok || bye.Text != "too many connections" {
+		t.Fatalf("Start error = %#v, want ErrServerBye", err)
+	}
+	if state := imap.State(); state != StateLogout {
+		t.Fatalf("state = %s, want %s", state, StateLogout)
+	}
+}
+
+func TestServerByeFailsPending(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error {
+		_, err := imap.SendSync("NOOP")
+		return err
+	})
+	srv.expect("a0 NOOP")
+	srv.send("* BYE [ALERT] shutting down")
+
+	err := wait(t, done)
+	if bye, ok := err.(*ErrServerBye); !ok || bye.Code != "ALERT" || bye.Text != "shutting down" {
+		t.Fatalf("NOOP error = %#v, want ErrServerBye", err)
+	}
+	if _, err := imap.SendSync("NOOP"); err != imap.Err() || err == nil {
+		t.Fatalf("NOOP after BYE = %v, want %v", err, imap.Err())
+	}
+}
+
+func TestLogout(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	srv.expect("a0 LOGIN joe secret")
+	srv.send("a0 OK [CAPABILITY IMAP4rev1] Logged in")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+	if state := imap.State(); state != StateAuthenticated {
+		t.Fatalf("state = %s, want %s", state, StateAuthenticated)
+	}
+
+	done = async(imap.Logout)
+	srv.expect("a1 LOGOUT")
+	srv.send("* BYE logging out", "a1 OK Logout completed")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Logout: %s", err)
+	}
+	if _, err := imap.SendSync("NOOP"); err != ErrLoggedOut {
+		t.Fatalf("NOOP after Logout = %v, want ErrLoggedOut", err)
+	}
+}
@@ -0,0 +1,143 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrPending is returned by Result for a command still in flight.
+var ErrPending = errors.New("imap: command not complete")
+
+// ErrAbandoned is returned by Result for a cancelled command.
+var ErrAbandoned = errors.New("imap: command abandoned")
+
+// Command is a command in flight, as returned by SendAsync and the
+// Async variants of the commands.
+//
+// The untagged responses to the command are kept until it completes,
+// to be returned by Result in the status' Extra, unless the caller
+// asks for them as they arrive with Responses.  Either way nothing
+// waits on the caller: a Command that is dropped unread costs only
+// the memory of its responses.
+type Command struct {
+	imap *IMAP
+	cmd  *command
+
+	once     sync.Once
+	streamed bool
+	taken    bool
+}
+
+// SendAsync sends a command and returns without waiting for its
+// responses.  It blocks only until the command can be sent; see
+// doc.go.
+func (imap *IMAP) SendAsync(format string, args ...interface{}) (*Command, error) {
+	return imap.SendAsyncContext(context.Background(), format, args...)
+}
+
+// SendAsyncContext is SendAsync with a context governing the wait
+// until the command can be sent.
+func (imap *IMAP) SendAsyncContext(ctx context.Context, format string, args ...interface{}) (*Command, error) {
+	text := fmt.Sprintf(format, args...)
+	cmd := newCommand(text, nil)
+	cmd.keep = true
+	if _, err := imap.issue(ctx, cmd, text); err != nil {
+		return nil, err
+	}
+	return &Command{imap: imap, cmd: cmd}, nil
+}
+
+// Tag returns the command's tag, as in "a12".
+func (c *Command) Tag() string {
+	return fmt.Sprintf("a%d", int(c.cmd.tag))
+}
+
+// Done returns a channel that is closed when the command completes or
+// fails.
+func (c *Command) Done() <-chan struct{} {
+	return c.cmd.finished
+}
+
+// Responses returns a channel on which the command's untagged
+// responses are sent as they arrive, from the first, and which is
+// closed when the command completes, fails or is cancelled.  Once it
+// is called, the responses are no longer kept for Result, and the
+// channel must be read to the end or the command cancelled.
+func (c *Command) Responses() <-chan interface{} {
+	c.once.Do(func() {
+		ch := make(chan interface{})
+		c.cmd.mu.Lock()
+		c.cmd.ch = ch
+		c.streamed = true
+		c.cmd.mu.Unlock()
+		go c.cmd.forward()
+	})
+	return c.cmd.ch
+}
+
+// Wait waits for the command to complete and returns Result.  If ctx
+// is done first, Wait returns its error, and the command carries on.
+func (c *Command) Wait(ctx context.Context) (*ResponseStatus, error) {
+	select {
+	case <-c.cmd.finished:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return c.Result()
+}
+
+// Result returns the command's tagged status, with the untagged
+// responses in its Extra unless they were read from Responses.  The
+// error is an *IMAPError if the status isn't OK, ErrPending before the
+// command completes, or the connection's error if it failed.
+func (c *Command) Result() (*ResponseStatus, error) {
+	select {
+	case <-c.cmd.finished:
+	default:
+		return nil, ErrPending
+	}
+
+	c.cmd.mu.Lock()
+	status, abandoned := c.cmd.status, c.cmd.abandoned
+	if status != nil && !c.streamed && !c.taken {
+		c.taken = true
+		if len(c.cmd.queue) > 0 {
+			status.Extra = c.cmd.queue
+		}
+		c.cmd.queue = nil
+	}
+	c.cmd.mu.Unlock()
+
+	switch {
+	case abandoned:
+		return nil, ErrAbandoned
+	case status == nil:
+		return nil, c.imap.Err()
+	case status.Status != OK:
+		return status, statusError(status)
+	}
+	return status, nil
+}
+
+// statusError returns the error for a status other than OK.
+func statusError(status *ResponseStatus) error {
+	return &IMAPError{status.Status, status.Text, status.Code}
+}
+
+// Cancel abandons the command: its responses are dropped, and Result
+// returns ErrAbandoned.  See IMAP for what that means on the wire.
+func (c *Command) Cancel() {
+	c.imap.abandon(c.cmd)
+}
+
+// wait is Wait as the synchronous commands do it: the command is
+// abandoned if ctx is done first.
+func (c *Command) wait(ctx context.Context) (*ResponseStatus, error) {
+	status, err := c.Wait(ctx)
+	if err == ctx.Err() && err != nil {
+		c.Cancel()
+	}
+	return status, err
+}
@@ -0,0 +1,122 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCommandResult(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var a, b *Command
+	sent := async(func() (err error) {
+		if a, err = imap.FetchAsync("1:2", []string{"FLAGS"}); err != nil {
+			return err
+		}
+		b, err = imap.FetchAsync("3", []string{"FLAGS"})
+		return err
+	})
+	srv.expect("a0 FETCH 1:2 FLAGS")
+	srv.expect("a1 FETCH 3 FLAGS")
+	if err := wait(t, sent); err != nil {
+		t.Fatalf("FetchAsync: %s", err)
+	}
+	if _, err := a.Result(); err != ErrPending {
+		t.Fatalf("Result before completion: got %v, want ErrPending", err)
+	}
+
+	srv.send(
+		`* 3 FETCH (FLAGS (\Seen))`,
+		"a1 OK done",
+		`* 1 FETCH (FLAGS ())`,
+		`* 2 FETCH (FLAGS ())`,
+		"a0 NO partly gone",
+	)
+	status, err := b.Wait(context.Background())
+	if err != nil || len(status.Extra) != 1 || status.Extra[0].(*ResponseFetch).Msg != 3 {
+		t.Fatalf("b: got %v, %v", status, err)
+	}
+	status, err = a.Wait(context.Background())
+	if _, ok := err.(*IMAPError); !ok || status == nil || len(status.Extra) != 2 {
+		t.Fatalf("a: got %v, %v; want the NO with two messages", status, err)
+	}
+	if a.Tag() != "a0" {
+		t.Errorf("Tag() = %q, want a0", a.Tag())
+	}
+}
+
+// fetchAsync issues a FETCH of all UIDs as a0.
+func fetchAsync(t *testing.T, imap *IMAP, srv *testServer) *Command {
+	t.Helper()
+	var c *Command
+	sent := async(func() (err error) {
+		c, err = imap.FetchAsync("1:*", []string{"UID"})
+		return err
+	})
+	srv.expect("a0 FETCH 1:* UID")
+	if err := wait(t, sent); err != nil {
+		t.Fatalf("FetchAsync: %s", err)
+	}
+	return c
+}
+
+func TestCommandResponses(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	c := fetchAsync(t, imap, srv)
+	go func() {
+		for i := 1; i <= 50; i++ {
+			srv.send(fmt.Sprintf("* %d FETCH (UID %d)", i, 100+i))
+		}
+		srv.send("a0 OK done")
+	}()
+
+	n := 0
+	for r := range c.Responses() {
+		n++
+		if f := r.(*ResponseFetch); f.Msg != n {
+			t.Fatalf("got message %d, want %d", f.Msg, n)
+		}
+	}
+	if n != 50 {
+		t.Fatalf("got %d messages, want 50", n)
+	}
+	status, err := c.Result()
+	if err != nil || status.Extra != nil {
+		t.Fatalf("Result: got %v, %v; want OK without Extra", status, err)
+	}
+}
+
+func TestCommandUnreadDoesntBlock(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	c := fetchAsync(t, imap, srv)
+	c.Responses() // and never read
+	for i := 1; i <= 100; i++ {
+		srv.send(fmt.Sprintf("* %d FETCH (UID %d)", i, i))
+	}
+
+	// The connection carries on regardless.
+	done := async(func() error {
+		_, err := imap.Capability()
+		return err
+	})
+	srv.expect("a1 CAPABILITY")
+	srv.send("* CAPABILITY IMAP4rev1", "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Capability: %s", err)
+	}
+
+	c.Cancel()
+	select {
+	case <-c.Responses():
+		for range c.Responses() {
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stream not closed by Cancel")
+	}
+	srv.send("a0 OK done")
+	<-c.Done()
+	if _, err := c.Result(); err != ErrAbandoned {
+		t.Fatalf("Result after Cancel: got %v, want ErrAbandoned", err)
+	}
+}
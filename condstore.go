@@ -0,0 +1,61 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+)
+
+// SelectOption is a parameter of SELECT and EXAMINE.
+type SelectOption string
+
+// SelectCondStore turns on CONDSTORE (RFC 7162) for the session and
+// has the server report the mailbox's HIGHESTMODSEQ.
+const SelectCondStore SelectOption = "CONDSTORE"
+
+// FetchModifier is a modifier of FETCH.
+type FetchModifier string
+
+// ChangedSince restricts a FETCH to messages whose mod-sequence is
+// greater than modseq.  The MODSEQ item is fetched along.
+func ChangedSince(modseq uint64) FetchModifier {
+	return FetchModifier(fmt.Sprintf("CHANGEDSINCE %d", modseq))
+}
+
+// StoreModifier is a modifier of STORE.
+type StoreModifier string
+
+// UnchangedSince makes a STORE skip the messages whose mod-sequence
+// is greater than modseq; see ModifiedError.
+func UnchangedSince(modseq uint64) StoreModifier {
+	return StoreModifier(fmt.Sprintf("UNCHANGEDSINCE %d", modseq))
+}
+
+// ModifiedError is returned by Store when messages were left alone
+// because they changed since the UnchangedSince mod-sequence.
+type ModifiedError struct {
+	// Messages is the set of the messages, as in "7,9:11".
+	Messages string
+}
+
+func (e *ModifiedError) Error() string {
+	return "imap: messages modified: " + e.Messages
+}
+
+// EnableCondStore turns on CONDSTORE for the session, after which the
+// server includes MODSEQ in the FETCH responses it sends.
+func (imap *IMAP) EnableCondStore() error {
+	return imap.EnableCondStoreContext(context.Background())
+}
+
+func (imap *IMAP) EnableCondStoreContext(ctx context.Context) error {
+	_, err := imap.EnableContext(ctx, "CONDSTORE")
+	return err
+}
+
+func (imap *IMAP) EnableCondStoreAsync() (*Command, error) {
+	return imap.EnableCondStoreAsyncContext(context.Background())
+}
+
+func (imap *IMAP) EnableCondStoreAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.EnableAsyncContext(ctx, "CONDSTORE")
+}
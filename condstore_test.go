@@ -0,0 +1,127 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCondStore(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	done := async(imap.EnableCondStore)
+	srv.expect("a0 ENABLE CONDSTORE")
+	srv.send("* ENABLED CONDSTORE", "a0 OK enabled")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("EnableCondStore: %s", err)
+	}
+
+	var examine *ResponseExamine
+	done = async(func() (err error) {
+		examine, err = imap.Select("INBOX", SelectCondStore)
+		return err
+	})
+	srv.expect(`a1 SELECT "INBOX" (CONDSTORE)`)
+	srv.send(
+		"* 172 EXISTS",
+		"* OK [UIDVALIDITY 3857529045] UIDs valid",
+		"* OK [HIGHESTMODSEQ 715194045007] Highest",
+		"a1 OK [READ-WRITE] done",
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	if examine.HighestModSeq != 715194045007 || examine.NoModSeq {
+		t.Errorf("HighestModSeq %d, NoModSeq %v", examine.HighestModSeq, examine.NoModSeq)
+	}
+
+	var fetched []*ResponseFetch
+	done = async(func() (err error) {
+		fetched, err = imap.Fetch("1:*", []string{"FLAGS"}, ChangedSince(12345))
+		return err
+	})
+	srv.expect("a2 FETCH 1:* FLAGS (CHANGEDSINCE 12345)")
+	srv.send(`* 7 FETCH (FLAGS (\Seen) MODSEQ (12346))`, "a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	if len(fetched) != 1 || fetched[0].ModSeq != 12346 {
+		t.Fatalf("fetched %#v", fetched)
+	}
+
+	var stored []*ResponseFetch
+	done = async(func() (err error) {
+		stored, err = imap.Store("7,9", StoreAdd, NewFlags(FlagDeleted), UnchangedSince(12346))
+		return err
+	})
+	srv.expect(`a3 STORE 7,9 (UNCHANGEDSINCE 12346) +FLAGS (\Deleted)`)
+	srv.send(`* 7 FETCH (FLAGS (\Seen \Deleted) MODSEQ (12347))`, "a3 OK [MODIFIED 9] Conditional STORE failed")
+	err := wait(t, done)
+	if e, ok := err.(*ModifiedError); !ok || e.Messages != "9" {
+		t.Fatalf("Store: got %v, want MODIFIED 9", err)
+	}
+	if len(stored) != 1 || stored[0].ModSeq != 12347 {
+		t.Errorf("stored %#v", stored)
+	}
+
+	var search *ResponseSearch
+	done = async(func() (err error) {
+		search, err = imap.Search("MODSEQ 12346")
+		return err
+	})
+	srv.expect("a4 SEARCH MODSEQ 12346")
+	srv.send("* SEARCH 2 7 (MODSEQ 12347)", "a4 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Search: %s", err)
+	}
+	if want := (&ResponseSearch{IDs: []int{2, 7}, ModSeq: 12347}); !reflect.DeepEqual(search, want) {
+		t.Errorf("got %#v, want %#v", search, want)
+	}
+
+	var status *ResponseMailboxStatus
+	done = async(func() (err error) {
+		status, err = imap.Status("Archive", "MESSAGES", "HIGHESTMODSEQ")
+		return err
+	})
+	srv.expect(`a5 STATUS "Archive" (MESSAGES HIGHESTMODSEQ)`)
+	srv.send(`* STATUS "Archive" (MESSAGES 3 HIGHESTMODSEQ 7011231777)`, "a5 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Status: %s", err)
+	}
+	if status.Items["HIGHESTMODSEQ"] != 7011231777 || status.Items["MESSAGES"] != 3 {
+		t.Errorf("status %#v", status)
+	}
+}
+
+func TestSelectNoModSeq(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var examine *ResponseExamine
+	done := async(func() (err error) {
+		examine, err = imap.Examine("Drafts", SelectCondStore)
+		return err
+	})
+	srv.expect(`a0 EXAMINE "Drafts" (CONDSTORE)`)
+	srv.send("* 3 EXISTS", "* OK [NOMODSEQ] no mod-sequences here", "a0 OK [READ-ONLY] done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Examine: %s", err)
+	}
+	if !examine.NoModSeq || examine.Exists != 3 {
+		t.Errorf("got %#v", examine)
+	}
+}
+
+func TestSearchEmpty(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var search *ResponseSearch
+	done := async(func() (err error) {
+		search, err = imap.UIDSearch("UNSEEN")
+		return err
+	})
+	srv.expect("a0 UID SEARCH UNSEEN")
+	srv.send("* SEARCH", "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("UIDSearch: %s", err)
+	}
+	if len(search.IDs) != 0 {
+		t.Errorf("got %v", search.IDs)
+	}
+}
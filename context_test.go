@@ -0,0 +1,113 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serve answers commands until the connection closes, using reply to
+// produce the response lines for each command.
+func (s *testServer) serve(reply func(tag, cmd string) []string) {
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		tag, cmd, _ := strings.Cut(line, " ")
+		s.send(reply(tag, cmd)...)
+	}
+}
+
+func TestConcurrentFetch(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	go srv.serve(func(tag, cmd string) []string {
+		var msg int
+		fmt.Sscanf(cmd, "FETCH %d FLAGS", &msg)
+		return []string{
+			fmt.Sprintf("* %d FETCH (FLAGS (\\Seen))", msg),
+			tag + " OK done",
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(msg int) {
+			defer wg.Done()
+			fetches, err := imap.Fetch(fmt.Sprint(msg), []string{"FLAGS"})
+			if err != nil {
+				t.Errorf("FETCH %d: %s", msg, err)
+				return
+			}
+			if len(fetches) != 1 || fetches[0].Msg != msg {
+				t.Errorf("FETCH %d: got %v", msg, fetches)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCancelSentCommand(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error {
+		_, err := imap.FetchContext(ctx, "1:*", []string{"FLAGS"})
+		return err
+	})
+	srv.expect("a0 FETCH 1:* FLAGS")
+	cancel()
+	if err := wait(t, done); err != context.Canceled {
+		t.Fatalf("FETCH error = %v, want context.Canceled", err)
+	}
+
+	// The server finishes the abandoned FETCH; its data is dropped and
+	// the connection carries on.
+	srv.send("* 1 FETCH (FLAGS ())", "a0 OK done")
+	done = async(func() error {
+		_, err := imap.Fetch("2", []string{"FLAGS"})
+		return err
+	})
+	srv.expect("a1 FETCH 2 FLAGS")
+	srv.send("* 2 FETCH (FLAGS ())", "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("FETCH after cancel: %s", err)
+	}
+}
+
+func TestCancelWaitingCommand(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	first := async(func() error {
+		_, err := imap.SendSync("NOOP")
+		return err
+	})
+	srv.expect("a0 NOOP")
+
+	// The FETCH can't be sent while NOOP is pending, so it is never
+	// sent at all.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := imap.FetchContext(ctx, "1", []string{"FLAGS"}); err != context.DeadlineExceeded {
+		t.Fatalf("FETCH error = %v, want context.DeadlineExceeded", err)
+	}
+
+	srv.send("a0 OK done")
+	if err := wait(t, first); err != nil {
+		t.Fatalf("NOOP: %s", err)
+	}
+	done := async(func() error {
+		_, err := imap.SendSync("NOOP")
+		return err
+	})
+	srv.expect("a1 NOOP")
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("NOOP: %s", err)
+	}
+}
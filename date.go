@@ -0,0 +1,236 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// internalDateLayout is the INTERNALDATE format from RFC 3501
+// ("date-time"); the day may be space-padded.
+const internalDateLayout = "_2-Jan-2006 15:04:05 -0700"
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March,
+	"apr": time.April, "may": time.May, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+var weekdayNames = map[string]bool{
+	"mon": true, "tue": true, "wed": true, "thu": true,
+	"fri": true, "sat": true, "sun": true,
+}
+
+// zoneOffsets maps the zone names of RFC 5322 section 4.3, plus a few
+// that show up in real mail anyway, to their offset in hours.
+var zoneOffsets = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+	"BST": 1, "CET": 1, "CEST": 2, "MET": 1, "MEST": 2,
+	"EET": 2, "EEST": 3, "MSK": 3, "JST": 9, "KST": 9, "HKT": 8,
+	"AEST": 10, "AEDT": 11, "NZST": 12, "NZDT": 13,
+}
+
+// ParseInternalDate parses the INTERNALDATE of a message.  Servers
+// that don't quite follow the RFC 3501 format are handled by falling
+// back to ParseDate.
+func ParseInternalDate(s string) (time.Time, error) {
+	if t, err := time.Parse(internalDateLayout, s); err == nil {
+		return t, nil
+	}
+	return ParseDate(s)
+}
+
+// ParseDate parses an RFC 5322 date as found in the Date header and
+// the envelope.  It is lenient about the obsolete and malformed forms
+// seen in real mail: the weekday may be missing or wrong, the year may
+// have two or three digits, seconds may be missing, the zone may be a
+// name (military zones are taken as UTC, per the RFC) or missing
+// altogether, comments are ignored, and asctime-style ordering
+// ("Fri Oct 14 13:51:22 2011") is accepted.
+func ParseDate(s string) (time.Time, error) {
+	var (
+		day, year  = -1, -1
+		yearDigits int
+		month      time.Month
+		hour, min  int
+		sec        int
+		haveTime   bool
+		loc        = time.UTC
+		haveZone   bool
+	)
+
+	bad := func() (time.Time, error) {
+		return time.Time{}, fmt.Errorf("invalid date %q", s)
+	}
+
+	for _, tok := range dateTokens(s) {
+		switch {
+		case strings.IndexByte(tok, ':') > 0 && !haveTime:
+			parts := strings.Split(tok, ":")
+			if len(parts) < 2 || len(parts) > 3 {
+				return bad()
+			}
+			var nums [3]int
+			for i, p := range parts {
+				n, err := strconv.Atoi(p)
+				if err != nil {
+					return bad()
+				}
+				nums[i] = n
+			}
+			hour, min, sec = nums[0], nums[1], nums[2]
+			if hour > 23 || min > 59 || sec > 60 {
+				return bad()
+			}
+			if sec == 60 {
+				// Leap seconds aren't representable; close enough.
+				sec = 59
+			}
+			haveTime = true
+
+		case (tok[0] == '+' || tok[0] == '-') && len(tok) > 1 && !haveZone:
+			offset, ok := parseZoneOffset(tok[1:])
+			if !ok {
+				return bad()
+			}
+			if tok[0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone("", offset)
+			haveZone = true
+
+		case isDigits(tok):
+			n, _ := strconv.Atoi(tok)
+			switch {
+			case month == 0 && day < 0 && len(tok) <= 2:
+				// "14 Oct ..."; the day comes before the month.
+				day = n
+			case month != 0 && day < 0 && len(tok) <= 2 && !haveTime:
+				// asctime's "Oct 14 ...".
+				day = n
+			case year < 0:
+				year = n
+				yearDigits = len(tok)
+			default:
+				return bad()
+			}
+
+		default:
+			lower := strings.ToLower(tok)
+			if len(lower) >= 3 {
+				if m, ok := monthNames[lower[:3]]; ok && month == 0 {
+					month = m
+					continue
+				}
+				if weekdayNames[lower[:3]] {
+					continue
+				}
+			}
+			if !haveZone && haveTime {
+				upper := strings.ToUpper(tok)
+				if hours, ok := zoneOffsets[upper]; ok {
+					loc = time.FixedZone(upper, hours*60*60)
+					haveZone = true
+					continue
+				}
+				if len(upper) == 1 && upper[0] >= 'A' && upper[0] <= 'Z' && upper != "J" {
+					haveZone = true
+					continue
+				}
+			}
+			// Unknown words (stray zone names, "at", etc.) are
+			// ignored rather than rejecting the whole date.
+		}
+	}
+
+	if day < 1 || day > 31 || month == 0 || year < 0 {
+		return bad()
+	}
+
+	switch {
+	case yearDigits <= 2 && year < 50:
+		year += 2000
+	case yearDigits <= 3 && year < 1000:
+		year += 1900
+	}
+
+	t := time.Date(year, month, day, hour, min, sec, 0, loc)
+	if t.Day() != day {
+		// E.g. "31 Feb": time.Date would silently normalise it.
+		return bad()
+	}
+	return t, nil
+}
+
+// dateTokens splits a date into words, dropping comments and treating
+// commas and the dashes of "14-Oct-2011" as separators.
+func dateTokens(s string) []string {
+	var (
+		toks  []string
+		cur   []byte
+		depth int
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			toks = append(toks, string(cur))
+			cur = cur[:0]
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',':
+			flush()
+		case c == '-' && len(cur) > 0:
+			// A dash inside a word separates "14-Oct-2011"; a
+			// leading dash is a zone offset sign.
+			flush()
+		default:
+			cur = append(cur, c)
+		}
+	}
+	flush()
+	return toks
+}
+
+// parseZoneOffset parses the "hhmm" or "hh:mm" part of a numeric zone
+// and returns the offset in seconds.
+func parseZoneOffset(s string) (int, bool) {
+	s = strings.Replace(s, ":", "", 1)
+	if len(s) == 2 {
+		s += "00"
+	}
+	if len(s) != 4 || !isDigits(s) {
+		return 0, false
+	}
+	hh, _ := strconv.Atoi(s[:2])
+	mm, _ := strconv.Atoi(s[2:])
+	if mm > 59 {
+		return 0, false
+	}
+	return (hh*60 + mm) * 60, true
+}
+
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
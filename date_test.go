@@ -0,0 +1,119 @@
+package imap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	pdt := time.FixedZone("", -7*60*60)
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"Fri, 14 Oct 2011 13:51:22 -0700", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+		{"14 Oct 2011 13:51:22 -0700", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+		{"Fri, 14 Oct 2011 13:51:22 -0700 (PDT)", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+		{"Fri, 14 Oct 2011 13:51 -0700", time.Date(2011, 10, 14, 13, 51, 0, 0, pdt)},
+		{"Fri, 14 Oct 11 13:51:22 PDT", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+		{"Thu, 14 Oct 99 13:51:22 GMT", time.Date(1999, 10, 14, 13, 51, 22, 0, time.UTC)},
+		{"Thu, 14 Oct 111 13:51:22 GMT", time.Date(2011, 10, 14, 13, 51, 22, 0, time.UTC)},
+		{"Fri, 14 oct 2011 20:51:22 Z", time.Date(2011, 10, 14, 20, 51, 22, 0, time.UTC)},
+		{"Fri, 14 Oct 2011 20:51:22 A", time.Date(2011, 10, 14, 20, 51, 22, 0, time.UTC)},
+		{"Fri, 14 Oct 2011 20:51:22", time.Date(2011, 10, 14, 20, 51, 22, 0, time.UTC)},
+		{"Friday, 14 October 2011 13:51:22 -07:00", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+		{"Fri Oct 14 20:51:22 2011", time.Date(2011, 10, 14, 20, 51, 22, 0, time.UTC)},
+		{"14-Oct-2011 13:51:22 -0700", time.Date(2011, 10, 14, 13, 51, 22, 0, pdt)},
+	}
+	for _, test := range tests {
+		got, err := ParseDate(test.input)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %s", test.input, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("ParseDate(%q) = %s, want %s", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestParseDateInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"yesterday",
+		"Fri, 31 Feb 2011 13:51:22 -0700",
+		"Fri, Oct 2011 13:51:22 -0700",
+		"Fri, 14 Oct 2011 25:51:22 -0700",
+		"Fri, 14 Oct 2011 13:51:22 -07x0",
+	} {
+		if got, err := ParseDate(input); err == nil {
+			t.Errorf("ParseDate(%q) = %s, want error", input, got)
+		}
+	}
+}
+
+func TestParseInternalDate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"14-Oct-2011 20:51:30 +0000", time.Date(2011, 10, 14, 20, 51, 30, 0, time.UTC)},
+		{" 4-Oct-2011 20:51:30 +0000", time.Date(2011, 10, 4, 20, 51, 30, 0, time.UTC)},
+		{"4-Oct-2011 20:51:30 +0000", time.Date(2011, 10, 4, 20, 51, 30, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := ParseInternalDate(test.input)
+		if err != nil {
+			t.Errorf("ParseInternalDate(%q): %s", test.input, err)
+			continue
+		}
+		if !got.Equal(test.expected) {
+			t.Errorf("ParseInternalDate(%q) = %s, want %s", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestFetchDates(t *testing.T) {
+	pdt := time.FixedZone("", -7*60*60)
+	tests := []struct {
+		date, internal     string
+		time, internalTime time.Time
+	}{
+		{`"Fri, 14 Oct 2011 13:51:22 -0700"`, `"14-Oct-2011 20:51:30 +0000"`,
+			time.Date(2011, 10, 14, 13, 51, 22, 0, pdt), time.Date(2011, 10, 14, 20, 51, 30, 0, time.UTC)},
+		{`"14 Oct 11 13:51:22 PDT"`, `" 4-Oct-2011 20:51:30 -0700"`,
+			time.Date(2011, 10, 14, 13, 51, 22, 0, pdt), time.Date(2011, 10, 4, 20, 51, 30, 0, pdt)},
+		{`"Fri Oct 14 20:51:22 2011"`, `"4-Oct-2011 20:51:30 +0000"`,
+			time.Date(2011, 10, 14, 20, 51, 22, 0, time.UTC), time.Date(2011, 10, 4, 20, 51, 30, 0, time.UTC)},
+		// An unreadable date leaves the zero time, and the raw string.
+		{`"sometime last week"`, `"14-Oct-2011 20:51:30 +0000"`,
+			time.Time{}, time.Date(2011, 10, 14, 20, 51, 30, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		input := "* 1 FETCH (ENVELOPE (" + test.date + ` "hi" NIL NIL NIL NIL NIL NIL NIL NIL) INTERNALDATE ` + test.internal + ")\r\n"
+		r := &reader{newParser(bytes.NewBufferString(input))}
+		_, resp, err := r.readResponse()
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+		fetch, ok := resp.(*ResponseFetch)
+		if !ok {
+			t.Errorf("%q: got %#v", input, resp)
+			continue
+		}
+		if date := fetch.Envelope.Date; date == nil || `"`+*date+`"` != test.date {
+			t.Errorf("%q: Envelope.Date = %v", input, date)
+		}
+		if !fetch.Envelope.Time.Equal(test.time) {
+			t.Errorf("%q: Envelope.Time = %s, want %s", input, fetch.Envelope.Time, test.time)
+		}
+		if `"`+fetch.InternalDate+`"` != test.internal {
+			t.Errorf("%q: InternalDate = %q", input, fetch.InternalDate)
+		}
+		if !fetch.InternalTime.Equal(test.internalTime) {
+			t.Errorf("%q: InternalTime = %s, want %s", input, fetch.InternalTime, test.internalTime)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// DialTLS connects to addr (host:port, usually port 993) over TLS and
+// reads the server's greeting.  A nil config uses the defaults, with
+// the server name taken from addr.  ctx bounds the connection and the
+// wait for the greeting.
+func DialTLS(ctx context.Context, addr string, config *tls.Config) (*IMAP, error) {
+	return DialTLSWith(ctx, addr, config, nil)
+}
+
+// DialTLSWith is DialTLS that calls setup, if not nil, on the
+// connection before reading the greeting, to set what must be set
+// before Start: KeepAlive, MaxLineLength and MaxLiteralLength.
+func DialTLSWith(ctx context.Context, addr string, config *tls.Config, setup func(*IMAP)) (*IMAP, error) {
+	d := tls.Dialer{Config: config}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return startConn(ctx, conn, setup)
+}
+
+// Dial is DialTLS without TLS, for servers on the local machine or
+// tests.
+func Dial(ctx context.Context, addr string) (*IMAP, error) {
+	return DialWith(ctx, addr, nil)
+}
+
+// DialWith is Dial with setup, as for DialTLSWith.
+func DialWith(ctx context.Context, addr string, setup func(*IMAP)) (*IMAP, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return startConn(ctx, conn, setup)
+}
+
+func startConn(ctx context.Context, conn net.Conn, setup func(*IMAP)) (*IMAP, error) {
+	// Give up on the greeting if ctx is done first.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	imap := New(conn, conn)
+	if setup != nil {
+		setup(imap)
+	}
+	_, err := imap.Start()
+	if !stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return imap, nil
+}
+
+// dialFunc returns dial, or if it is nil a function dialling with
+// DialTLSWith, for Pool and Client.
+func dialFunc(dial func(context.Context, string) (*IMAP, error), config *tls.Config, setup func(*IMAP)) func(context.Context, string) (*IMAP, error) {
+	if dial != nil {
+		return dial
+	}
+	return func(ctx context.Context, server string) (*IMAP, error) {
+		return DialTLSWith(ctx, server, config, setup)
+	}
+}
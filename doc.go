@@ -23,29 +23,76 @@ This suggests one possible implementation strategy: a Go channel that
 provides all incoming untagged data.  However, that API is
 unsatisfactory to use.  Many requests, like "list all mailboxes", have
 an obvious answer (a []string of mailboxes).  Instead, this library
-has a notion of "the current request", and data that arrives in
-response to the current request is associated with that request.
-Extra data that was unexpected is sent via a separate channel of
-untagged data.
+attributes data that arrives in response to a pending request to that
+request.  Extra data that was unexpected is passed to the handlers
+registered with AddHandler.
 
 This means that in practice code like this will do what you want:
 
  lists, err := im.List(...)  // lists is now a list of all mailboxes
 
-Except that you must remember to either poll or have a goroutine
-reading from the Unsolicited channel for any extra unsolicited data.
+and unsolicited data, such as new mail arriving, is seen by a Handler:
 
-Because of this "current request" concept, this library does not
-support multiple parallel outstanding requests.  (If you had two
-outstanding "list mailboxes" requests, by the IMAP protocol there's no
-way to determine which data is in response to which request.)
+ type newMail struct{ imap.NopHandler }
+ func (newMail) OnExists(r *imap.ResponseExists) { ... }
 
-This is not a large loss: the RFC has confusing language about how
-clients MUST NOT send commands that result in ambiguity, without
-specifically defining what ambiguitity is (instead giving some
-examples).  It seems better left avoided, especially because the
-primary interesting operation (fetching messages) allows you to
-request multiple messages in a single call and stream in the results.
+ im.AddHandler(newMail{})
+
+Handlers are called as the data is read, so they must not block.  A
+QueueHandler instead queues the data on a bounded channel to be read
+at leisure, dropping the oldest (or newest) data rather than ever
+holding up the connection.  Every connection has one from the start,
+returned by Queue, so unsolicited data can be read without adding a
+handler at all:
+
+ for r := range im.Queue().C() { ... }
+
+To follow a mailbox, an IdleWatcher keeps an IDLE going, restarting
+it before the server's inactivity timeout, and turns what arrives
+into MailboxEvents.  On servers without IDLE it polls with NOOP.
+
+Servers offering IMAP4rev2 (RFC 9051) are switched to it once logged
+in, unless DisableRev2 is set; Version says which protocol is in
+effect.  The calls hide the differences where they can: SEARCH
+results arrive as ESEARCH, the RFC822 fetch items are asked for as
+their BODY equivalents, and there is no RECENT.
+
+An IMAP is one connection, and dies with it.  A Client wraps one
+that reconnects, logs in and re-selects its mailbox as needed, and a
+Pool hands out logged-in connections for many accounts at once.
+
+Several requests may be outstanding at once (pipelining); each is
+tracked by its tag, and its tagged completion goes to whoever sent
+it.  The hard part is the untagged data.  The RFC has confusing
+language about how clients MUST NOT send commands that result in
+ambiguity, without specifically defining what ambiguity is (instead
+giving some examples, in section 5.5).  This library resolves it with
+a few rules:
+
+ - Untagged data goes to the oldest pending request that asked for
+   that kind of data: LIST responses to a LIST, FETCH responses to a
+   FETCH or STORE naming that message (by sequence number, or by UID
+   for the UID commands), and so on.  Data nobody asked for goes to a
+   pending NOOP or CHECK, or else is unsolicited.
+
+ - Requests that change the connection state (LOGIN, SELECT, EXAMINE,
+   CLOSE, LOGOUT, IDLE, ...), and any request the library doesn't
+   know, are sent only when nothing else is outstanding, and nothing
+   else is sent until they complete.  What arrives during IDLE is
+   unsolicited, since that's what IDLE is for.
+
+ - Two requests that would collect the same kind of data, such as two
+   LISTs, or two FETCHes that share a message, are not outstanding at
+   the same time.
+
+ - A request using message sequence numbers is not sent while a
+   request is outstanding during which the server may send EXPUNGE
+   (anything but FETCH, STORE and SEARCH), since the numbers could be
+   renumbered under it.
+
+Send blocks until its request can go out under these rules, so bulk
+flag updates with STORE, or FETCHes of disjoint message ranges, are
+pipelined while anything ambiguous is serialised.
 
 */
 package imap
@@ -0,0 +1,48 @@
+package imap
+
+import (
+	"context"
+	"strings"
+)
+
+// Enable turns on extensions that change how the server talks to
+// the client (RFC 5161), such as CONDSTORE, QRESYNC or UTF8=ACCEPT.
+// It returns those the server enabled; the others it didn't know or
+// didn't want to.  Extensions enabled stay so for the session.
+func (imap *IMAP) Enable(caps ...string) ([]string, error) {
+	return imap.EnableContext(context.Background(), caps...)
+}
+
+func (imap *IMAP) EnableContext(ctx context.Context, caps ...string) ([]string, error) {
+	c, err := imap.EnableAsyncContext(ctx, caps...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make([]string, 0)
+	for _, extra := range resp.Extra {
+		if e, ok := extra.(*ResponseEnabled); ok {
+			enabled = append(enabled, e.Capabilities...)
+		} else {
+			imap.unsolicited(extra)
+		}
+	}
+	return enabled, nil
+}
+
+func (imap *IMAP) EnableAsync(caps ...string) (*Command, error) {
+	return imap.EnableAsyncContext(context.Background(), caps...)
+}
+
+func (imap *IMAP) EnableAsyncContext(ctx context.Context, caps ...string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "ENABLE %s", strings.Join(caps, " "))
+}
+
+// Enabled reports whether an extension was enabled during the
+// session.
+func (imap *IMAP) Enabled(cap string) bool {
+	return imap.caps.isEnabled(cap)
+}
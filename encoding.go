@@ -0,0 +1,34 @@
+package imap
+
+import (
+	"mime"
+	"strings"
+)
+
+// wordDecoder decodes RFC 2047 encoded words.  The standard library
+// only knows UTF-8, US-ASCII and ISO-8859-1; everything else (GB2312,
+// the rest of ISO-8859-x, Windows-125x, ISO-2022-JP, ...) goes through
+// charsetReader.
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes the RFC 2047 encoded words in a header value,
+// such as an envelope subject or address display name.  If the value
+// can't be decoded (malformed words, unknown charset) it is returned
+// unchanged along with the error.
+func DecodeHeader(s string) (string, error) {
+	if !strings.Contains(s, "=?") {
+		return s, nil
+	}
+	dec, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s, err
+	}
+	return dec, nil
+}
+
+// decodeHeader is DecodeHeader for parsing, where an undecodable
+// value is better kept raw than rejected.
+func decodeHeader(s string) string {
+	dec, _ := DecodeHeader(s)
+	return dec
+}
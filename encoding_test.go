@@ -0,0 +1,71 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeHeader(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"plain subject", "plain subject"},
+		{"=?UTF-8?B?w6l0w6k=?=", "été"},
+		{"=?utf-8?q?caf=C3=A9_au_lait?=", "café au lait"},
+		{"Re: =?UTF-8?B?w6l0w6k=?= =?UTF-8?B?w6l0w6k=?=", "Re: étéété"},
+		{"=?GB2312?B?1tDOxNb3zOI=?=", "中文主题"},
+		{"=?ISO-2022-JP?B?GyRCRnxLXDhsGyhC?=", "日本語"},
+		{"=?windows-1251?B?z/Do4uXy?=", "Привет"},
+		{"=?cp1251?B?z/Do4uXy?=", "Привет"},
+		{"=?ISO-8859-2?B?rmx1u2916Gv9?=", "Žluťoučký"},
+		{"=?latin2?B?rmx1u2916Gv9?=", "Žluťoučký"},
+		{"=?iso-8859-15?q?=A4_5?=", "€ 5"},
+		{"=?windows-1252?q?=93quoted=94?=", "“quoted”"},
+		{"=?ISO_8859-7?Q?=E3=E5=E9=E1?=", "γεια"},
+	}
+	for _, test := range tests {
+		got, err := DecodeHeader(test.input)
+		if err != nil {
+			t.Errorf("DecodeHeader(%q): %s", test.input, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("DecodeHeader(%q) = %q, want %q", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestDecodeHeaderUnknownCharset(t *testing.T) {
+	input := "=?X-NO-SUCH-CHARSET?B?YWJj?="
+	got, err := DecodeHeader(input)
+	if err == nil {
+		t.Fatalf("DecodeHeader(%q): expected error", input)
+	}
+	if got != input {
+		t.Fatalf("DecodeHeader(%q) = %q, want input unchanged", input, got)
+	}
+}
+
+func TestAddressListGroups(t *testing.T) {
+	s := []sexp{
+		[]sexp{"=?UTF-8?B?w6l0w6k=?=", nil, "summer", "example.com"},
+		[]sexp{nil, nil, "undisclosed-recipients", nil},
+		[]sexp{nil, nil, nil, nil},
+		[]sexp{nil, nil, "team", nil},
+		[]sexp{"Ann", nil, "ann", "example.com"},
+		[]sexp{nil, nil, "bob", "example.com"},
+		[]sexp{nil, nil, nil, nil},
+	}
+	expected := []Address{
+		{Name: "été", RawName: "=?UTF-8?B?w6l0w6k=?=", Address: "summer@example.com"},
+		{Name: "undisclosed-recipients", RawName: "undisclosed-recipients", Group: true},
+		{Name: "team", RawName: "team", Group: true, Members: []Address{
+			{Name: "Ann", RawName: "Ann", Address: "ann@example.com"},
+			{Address: "bob@example.com"},
+		}},
+	}
+	got := addressListFromSexp(s)
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("addressListFromSexp = %#v, want %#v", got, expected)
+	}
+}
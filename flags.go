@@ -0,0 +1,137 @@
+package imap
+
+import (
+	"sort"
+	"strings"
+)
+
+// Flag is a message flag: either a system flag such as FlagSeen or a
+// keyword.
+type Flag string
+
+// System flags; see RFC 3501 section 2.3.2.
+const (
+	FlagSeen     Flag = `\Seen`
+	FlagAnswered Flag = `\Answered`
+	FlagFlagged  Flag = `\Flagged`
+	FlagDeleted  Flag = `\Deleted`
+	FlagDraft    Flag = `\Draft`
+	FlagRecent   Flag = `\Recent`
+
+	// FlagWildcard appears in PERMANENTFLAGS when the client may
+	// create new keywords.
+	FlagWildcard Flag = `\*`
+)
+
+var systemFlags = map[string]Flag{
+	`\seen`:     FlagSeen,
+	`\answered`: FlagAnswered,
+	`\flagged`:  FlagFlagged,
+	`\deleted`:  FlagDeleted,
+	`\draft`:    FlagDraft,
+	`\recent`:   FlagRecent,
+	`\*`:        FlagWildcard,
+}
+
+// canonical returns the flag with system flags in their canonical
+// case, since servers are free to send "\SEEN".
+func (f Flag) canonical() Flag {
+	if len(f) > 0 && f[0] == '\\' {
+		if sys, ok := systemFlags[strings.ToLower(string(f))]; ok {
+			return sys
+		}
+	}
+	return f
+}
+
+// IsKeyword reports whether the flag is a keyword rather than a
+// system flag.
+func (f Flag) IsKeyword() bool {
+	return len(f) > 0 && f[0] != '\\'
+}
+
+// Flags is a set of message flags.
+type Flags map[Flag]struct{}
+
+// NewFlags returns a set of the given flags.
+func NewFlags(flags ...Flag) Flags {
+	f := make(Flags, len(flags))
+	f.Add(flags...)
+	return f
+}
+
+// flagsFromStrings converts a parsed flag list into a set.
+func flagsFromStrings(strs []string) Flags {
+	f := make(Flags, len(strs))
+	for _, s := range strs {
+		f[Flag(s).canonical()] = struct{}{}
+	}
+	return f
+}
+
+// flagsFromSexp converts the flag list of a FETCH response into a set.
+func flagsFromSexp(s sexp) Flags {
+	list := s.([]sexp)
+	flags := make(Flags, len(list))
+	for _, flag := range list {
+		flags[Flag(flag.(string)).canonical()] = struct{}{}
+	}
+	return flags
+}
+
+// Has reports whether flag is in the set.
+func (f Flags) Has(flag Flag) bool {
+	_, ok := f[flag.canonical()]
+	return ok
+}
+
+// Add adds flags to the set.  It panics on a nil set; use NewFlags.
+func (f Flags) Add(flags ...Flag) {
+	for _, flag := range flags {
+		f[flag.canonical()] = struct{}{}
+	}
+}
+
+// Remove removes flags from the set.
+func (f Flags) Remove(flags ...Flag) {
+	for _, flag := range flags {
+		delete(f, flag.canonical())
+	}
+}
+
+// Diff returns the flags that have to be added to and removed from f
+// to turn it into other.
+func (f Flags) Diff(other Flags) (added, removed Flags) {
+	added, removed = make(Flags), make(Flags)
+	for flag := range other {
+		if !f.Has(flag) {
+			added[flag] = struct{}{}
+		}
+	}
+	for flag := range f {
+		if !other.Has(flag) {
+			removed[flag] = struct{}{}
+		}
+	}
+	return added, removed
+}
+
+// List returns the flags in the set, sorted.
+func (f Flags) List() []Flag {
+	list := make([]Flag, 0, len(f))
+	for flag := range f {
+		list = append(list, flag)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// String formats the set as an IMAP flag list, e.g. `(\Seen foo)`.
+func (f Flags) String() string {
+	list := f.List()
+	strs := make([]string, len(list))
+	for i, flag := range list {
+		strs[i] = string(flag)
+	}
+	return "(" + strings.Join(strs, " ") + ")"
+}
@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	f := NewFlags(FlagSeen, "$Forwarded")
+	if !f.Has(`\SEEN`) || !f.Has(FlagSeen) || !f.Has("$Forwarded") {
+		t.Fatalf("%s: missing flags", f)
+	}
+	if f.Has(FlagDeleted) {
+		t.Fatalf("%s: unexpected %s", f, FlagDeleted)
+	}
+
+	f.Add(`\deleted`)
+	f.Remove(FlagSeen)
+	if got, want := f.String(), `($Forwarded \Deleted)`; got != want {
+		t.Fatalf("String() = %s, want %s", got, want)
+	}
+
+	added, removed := f.Diff(NewFlags(FlagDeleted, FlagFlagged))
+	if !reflect.DeepEqual(added, NewFlags(FlagFlagged)) {
+		t.Errorf("added = %s, want (\\Flagged)", added)
+	}
+	if !reflect.DeepEqual(removed, NewFlags("$Forwarded")) {
+		t.Errorf("removed = %s, want ($Forwarded)", removed)
+	}
+
+	if FlagSeen.IsKeyword() || !Flag("$Junk").IsKeyword() {
+		t.Errorf("IsKeyword misclassified flags")
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"* OK [PERMANENTFLAGS (\\Answered \\Seen $Junk \\*)] Flags permitted.\r\n",
+			&ResponsePermanentFlags{NewFlags(FlagAnswered, FlagSeen, "$Junk", FlagWildcard)},
+		},
+		{
+			"* FLAGS (\\Answered \\Flagged \\Draft \\Deleted \\Seen)\r\n",
+			&ResponseFlags{NewFlags(FlagAnswered, FlagFlagged, FlagDraft, FlagDeleted, FlagSeen)},
+		},
+		{
+			"* 12 FETCH (FLAGS (\\SEEN \\Recent))\r\n",
+			&ResponseFetch{Msg: 12, Flags: NewFlags(FlagSeen, FlagRecent)},
+		},
+	}
+	for _, test := range tests {
+		r := &reader{newParser(bytes.NewBufferString(test.input))}
+		_, resp, err := r.readResponse()
+		if err != nil {
+			t.Fatalf("parsing %q: %s", test.input, err)
+		}
+		if !reflect.DeepEqual(resp, test.expected) {
+			t.Fatalf("parsing %q: got %#v, want %#v", test.input, resp, test.expected)
+		}
+	}
+}
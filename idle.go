@@ -0,0 +1,252 @@
+package imap
+
+import (
+	"context"
+	"time"
+)
+
+// Idle issues IDLE (RFC 2177) and waits, with the data the server
+// sends meanwhile going to the handlers, until ctx is done.  It then
+// ends the IDLE with DONE and returns nil once the server has
+// acknowledged it.
+func (imap *IMAP) Idle(ctx context.Context) error {
+	ch := make(chan interface{}, 1)
+	cmd, err := imap.send(ctx, ch, "IDLE")
+	if err != nil {
+		return err
+	}
+
+	// Wait until the server says it's idling.  If ctx is done
+	// first, DONE goes out once it does, without waiting here.
+	idling := false
+	for !idling {
+		select {
+		case r, open := <-ch:
+			if !open {
+				// The server refused to idle, or the connection died.
+				return imap.commandError(cmd)
+			}
+			_, idling = r.(*ResponseContinuation)
+		case <-ctx.Done():
+			go func() {
+				for r := range ch {
+					if _, ok := r.(*ResponseContinuation); ok {
+						imap.write("DONE")
+					}
+				}
+			}()
+			return ctx.Err()
+		}
+	}
+
+	<-ctx.Done()
+	if err := imap.write("DONE"); err != nil {
+		return err
+	}
+	for range ch {
+	}
+	return imap.commandError(cmd)
+}
+
+// IdleAsync is Idle without the wait: it issues IDLE and returns, and
+// DONE goes out once the server is idling and ctx is done.  The
+// Command completes when the server acknowledges the DONE, or at once
+// if it refuses to idle.
+func (imap *IMAP) IdleAsync(ctx context.Context) (*Command, error) {
+	cmd := newCommand("IDLE", nil)
+	cmd.keep = true
+	cmd.cont = make(chan struct{}, 1)
+	if _, err := imap.issue(ctx, cmd, "IDLE"); err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-cmd.cont:
+		case <-cmd.finished:
+			return
+		}
+		select {
+		case <-ctx.Done():
+			imap.write("DONE")
+		case <-cmd.finished:
+		}
+	}()
+	return &Command{imap: imap, cmd: cmd}, nil
+}
+
+// commandError returns the error for a completed command: nil if it
+// succeeded, an *IMAPError if the server said no, or the connection's
+// error if it failed.
+func (imap *IMAP) commandError(cmd *command) error {
+	status := cmd.result()
+	if status == nil {
+		return imap.Err()
+	}
+	if status.Status != OK {
+		return statusError(status)
+	}
+	return nil
+}
+
+// MailboxEventType is the kind of change a MailboxEvent reports.
+type MailboxEventType int
+
+const (
+	// EventExists: the mailbox now has Count messages.
+	EventExists MailboxEventType = iota
+	// EventRecent: Count messages have the \Recent flag.
+	EventRecent
+	// EventExpunge: message SeqNum was removed.
+	EventExpunge
+	// EventVanished: the messages in Vanished were removed; see
+	// QRESYNC.
+	EventVanished
+	// EventFetch: message data, usually flags, changed; see Fetch.
+	EventFetch
+	// EventFlags: the flags defined in the mailbox changed.
+	EventFlags
+)
+
+// MailboxEvent is a change to the selected mailbox seen by an
+// IdleWatcher.
+type MailboxEvent struct {
+	Type     MailboxEventType
+	Count    int
+	SeqNum   int
+	Fetch    *ResponseFetch
+	Flags    Flags
+	Vanished *ResponseVanished
+}
+
+// mailboxEvent converts unsolicited data into an event, if it is one.
+func mailboxEvent(r interface{}) (MailboxEvent, bool) {
+	switch r := r.(type) {
+	case *ResponseExists:
+		return MailboxEvent{Type: EventExists, Count: r.Count}, true
+	case *ResponseRecent:
+		return MailboxEvent{Type: EventRecent, Count: r.Count}, true
+	case *ResponseExpunge:
+		return MailboxEvent{Type: EventExpunge, SeqNum: r.SeqNum}, true
+	case *ResponseVanished:
+		return MailboxEvent{Type: EventVanished, Vanished: r}, true
+	case *ResponseFetch:
+		return MailboxEvent{Type: EventFetch, SeqNum: r.Msg, Fetch: r}, true
+	case *ResponseFlags:
+		return MailboxEvent{Type: EventFlags, Flags: r.Flags}, true
+	}
+	return MailboxEvent{}, false
+}
+
+// Defaults for IdleWatcher.
+const (
+	// Servers may log out a client that has idled for 30 minutes.
+	DefaultIdleRefresh  = 29 * time.Minute
+	DefaultPollInterval = time.Minute
+)
+
+// IdleWatcher watches the selected mailbox for changes, using IDLE if
+// the server supports it and polling with NOOP otherwise.
+type IdleWatcher struct {
+	// Refresh is how often IDLE is restarted, to stay clear of the
+	// server's inactivity timeout; zero means DefaultIdleRefresh.
+	Refresh time.Duration
+
+	// PollInterval is how often NOOP is sent when the server has no
+	// IDLE; zero means DefaultPollInterval.
+	PollInterval time.Duration
+
+	// QueueSize bounds the events waiting to be delivered; when
+	// full, the oldest are dropped.  Zero means DefaultQueueSize.
+	// The client's Mailbox state is kept accurate regardless.
+	QueueSize int
+
+	imap *IMAP
+}
+
+// NewIdleWatcher returns a watcher for the mailbox selected on imap.
+func NewIdleWatcher(imap *IMAP) *IdleWatcher {
+	return &IdleWatcher{imap: imap}
+}
+
+// Watch delivers events about the selected mailbox to events until
+// ctx is done, at which point it ends the IDLE cleanly and returns
+// nil.  It returns early with the error if a command fails.
+func (w *IdleWatcher) Watch(ctx context.Context, events chan<- MailboxEvent) error {
+	queue := NewQueueHandler(w.QueueSize, DropOldest)
+	remove := w.imap.AddHandler(queue)
+	defer remove()
+
+	// The forwarder stops with ctx, or when Watch returns early.
+	forwardCtx, stopForward := context.WithCancel(ctx)
+	forwardDone := make(chan struct{})
+	go func() {
+		defer close(forwardDone)
+		for {
+			select {
+			case r := <-queue.C():
+				if e, ok := mailboxEvent(r); ok {
+					select {
+					case events <- e:
+					case <-forwardCtx.Done():
+						return
+					}
+				}
+			case <-forwardCtx.Done():
+				return
+			}
+		}
+	}()
+	defer func() {
+		stopForward()
+		<-forwardDone
+	}()
+
+	idle, err := w.imap.supports(ctx, "IDLE")
+	if err != nil {
+		return ignoreDone(ctx, err)
+	}
+	if !idle {
+		return w.poll(ctx)
+	}
+
+	refresh := w.Refresh
+	if refresh <= 0 {
+		refresh = DefaultIdleRefresh
+	}
+	for ctx.Err() == nil {
+		idleCtx, cancel := context.WithTimeout(ctx, refresh)
+		err := w.imap.Idle(idleCtx)
+		cancel()
+		if err != nil {
+			return ignoreDone(ctx, err)
+		}
+	}
+	return nil
+}
+
+func (w *IdleWatcher) poll(ctx context.Context) error {
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.imap.NoopContext(ctx); err != nil {
+				return ignoreDone(ctx, err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ignoreDone maps the error of a command interrupted by ctx to nil.
+func ignoreDone(ctx context.Context, err error) error {
+	if ctx.Err() != nil && err == ctx.Err() {
+		return nil
+	}
+	return err
+}
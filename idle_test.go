@@ -0,0 +1,214 @@
+package imap
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdle(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := recordingHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error { return imap.Idle(ctx) })
+	srv.expect("a0 IDLE")
+	srv.send("+ idling", "* 5 EXISTS")
+	if e, ok := h.next(t).(*ResponseExists); !ok || e.Count != 5 {
+		t.Fatalf("got %#v, want EXISTS 5", e)
+	}
+
+	cancel()
+	srv.expect("DONE")
+	srv.send("a0 OK IDLE terminated")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Idle: %s", err)
+	}
+}
+
+func TestIdleCancelledEarly(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error { return imap.Idle(ctx) })
+	srv.expect("a0 IDLE")
+	// The server is slow to start idling.
+	cancel()
+	if err := wait(t, done); err != context.Canceled {
+		t.Fatalf("Idle: got %v, want context.Canceled", err)
+	}
+
+	// The IDLE is still ended once it starts.
+	done = async(imap.Noop)
+	srv.send("+ idling")
+	srv.expect("DONE")
+	srv.send("a0 OK IDLE terminated")
+	srv.expect("a1 NOOP")
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("Noop: %s", err)
+	}
+}
+
+func TestIdleRefused(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error { return imap.Idle(context.Background()) })
+	srv.expect("a0 IDLE")
+	srv.send("a0 BAD no idling here")
+	if err := wait(t, done); err == nil || !strings.Contains(err.Error(), "no idling") {
+		t.Fatalf("Idle: got %v, want the server's refusal", err)
+	}
+}
+
+func TestIdleAsync(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := recordingHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var c *Command
+	done := async(func() (err error) {
+		c, err = imap.IdleAsync(ctx)
+		return err
+	})
+	srv.expect("a0 IDLE")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("IdleAsync: %s", err)
+	}
+	srv.send("+ idling", "* 7 EXISTS")
+	if e, ok := h.next(t).(*ResponseExists); !ok || e.Count != 7 {
+		t.Fatalf("got %#v, want EXISTS 7", e)
+	}
+	if _, err := c.Result(); err != ErrPending {
+		t.Errorf("Result: got %v while idling, want ErrPending", err)
+	}
+
+	cancel()
+	srv.expect("DONE")
+	srv.send("a0 OK IDLE terminated")
+	if _, err := c.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %s", err)
+	}
+
+	// A refusal completes the command without a DONE.
+	done = async(func() (err error) {
+		c, err = imap.IdleAsync(context.Background())
+		return err
+	})
+	srv.expect("a1 IDLE")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("IdleAsync: %s", err)
+	}
+	srv.send("a1 NO not now")
+	if _, err := c.Wait(context.Background()); err == nil || !strings.Contains(err.Error(), "not now") {
+		t.Fatalf("Wait: got %v, want the server's refusal", err)
+	}
+}
+
+func TestIdleWatcher(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	idles := make(chan string, 10)
+	go func() {
+		// Each IDLE reports a new message, and is ended by DONE.
+		var idleTag string
+		exists := 0
+		for {
+			line, err := srv.r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			switch {
+			case cmd == "CAPABILITY":
+				srv.send("* CAPABILITY IMAP4rev1 IDLE", tag+" OK done")
+			case cmd == "IDLE":
+				idleTag = tag
+				idles <- tag
+				exists++
+				srv.send("+ idling", "* "+strconv.Itoa(exists)+" EXISTS")
+			case tag == "DONE":
+				srv.send(idleTag + " OK IDLE terminated")
+			}
+		}
+	}()
+
+	w := NewIdleWatcher(imap)
+	w.Refresh = 20 * time.Millisecond
+	events := make(chan MailboxEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error { return w.Watch(ctx, events) })
+
+	for want := 1; want <= 3; want++ {
+		select {
+		case e := <-events:
+			if e.Type != EventExists || e.Count != want {
+				t.Fatalf("got %+v, want EXISTS %d", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event %d", want)
+		}
+	}
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	if len(idles) < 3 {
+		t.Fatalf("IDLE sent %d times, want at least 3", len(idles))
+	}
+}
+
+func TestIdleWatcherPolls(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	go srv.serve(func(tag, cmd string) []string {
+		switch cmd {
+		case "CAPABILITY":
+			return []string{"* CAPABILITY IMAP4rev1", tag + " OK done"}
+		case "NOOP":
+			return []string{"* 3 EXISTS", "* 1 EXPUNGE", tag + " OK done"}
+		}
+		t.Errorf("unexpected command %q", cmd)
+		return []string{tag + " BAD what?"}
+	})
+
+	w := NewIdleWatcher(imap)
+	w.PollInterval = 10 * time.Millisecond
+	events := make(chan MailboxEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error { return w.Watch(ctx, events) })
+
+	for _, want := range []MailboxEvent{
+		{Type: EventExists, Count: 3},
+		{Type: EventExpunge, SeqNum: 1},
+	} {
+		select {
+		case e := <-events:
+			if !reflect.DeepEqual(e, want) {
+				t.Fatalf("got %+v, want %+v", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event")
+		}
+	}
+	cancel()
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+}
+
+func TestIdleWatcherRefused(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 IDLE] ready")
+	go srv.serve(func(tag, cmd string) []string {
+		return []string{tag + " NO not now"}
+	})
+
+	// Watch returns the refusal, though ctx is never done.
+	w := NewIdleWatcher(imap)
+	done := async(func() error { return w.Watch(context.Background(), make(chan MailboxEvent)) })
+	if err := wait(t, done); err == nil || !strings.Contains(err.Error(), "not now") {
+		t.Fatalf("Watch: got %v, want the server's refusal", err)
+	}
+}
@@ -1,11 +1,13 @@
 package imap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
+	"time"
 )
 
 func check(err error) {
@@ -14,29 +16,159 @@ func check(err error) {
 	}
 }
 
+// ErrLoggedOut is returned for commands issued after Logout.
+var ErrLoggedOut = errors.New("imap: logged out")
+
+// ErrClosed is returned for commands issued after Close.
+var ErrClosed = errors.New("imap: connection closed")
+
+// State is the state of the connection; see RFC 3501 section 3.
+type State int
+
+const (
+	StateNotAuthenticated State = iota
+	StateAuthenticated
+	StateSelected
+	StateLogout
+)
+
+func (s State) String() string {
+	return []string{
+		"not authenticated",
+		"authenticated",
+		"selected",
+		"logout",
+	}[s]
+}
+
+// IMAP is a client connection.  It is safe for concurrent use by
+// multiple goroutines; commands from different goroutines are
+// pipelined where the protocol allows it (see doc.go).
+//
+// Every command also has an Async variant, which returns a *Command
+// once the command is sent, to be waited for later.
+//
+// Every command has a variant taking a context.Context.  Cancelling
+// the context while the command waits to be sent means it is never
+// sent.  Cancelling it once sent abandons the command: the call
+// returns the context's error, and whatever the server still sends in
+// response is read and dropped, so the connection stays usable.  An
+// abandoned IDLE or AUTHENTICATE is ended with DONE or "*" so the
+// server stops waiting.  If the connection can't be kept consistent,
+// because a write failed partway, it is failed for good and Err
+// reports why.
 type IMAP struct {
-	// Client thread.
-	nextTag int
+	// MaxLineLength limits the length of a response line; it must be
+	// set before Start.  Zero means DefaultMaxLineLength, a negative
+	// value no limit.  Longer lines fail the connection with a
+	// *LineTooLongError.
+	MaxLineLength int
+
+	// MaxLiteralLength limits the length of a literal, such as a
+	// message fetched whole, which doesn't count against
+	// MaxLineLength; it too must be set before Start.  Zero means
+	// DefaultMaxLiteralLength, a negative value no limit.  Longer
+	// literals fail the connection with a *LiteralTooLongError.
+	MaxLiteralLength int
+
+	// KeepAlive, if positive, is how long the connection may go
+	// without a command in flight before a NOOP is sent, so that
+	// the server or a NAT doesn't drop it.  Set it before Start,
+	// which for a connection from DialTLS, a Pool or a Client means
+	// in the setup function of DialTLSWith, Pool.Setup or
+	// Client.Setup.
+	KeepAlive time.Duration
+
+	// ReadTimeout, if positive, is how long the server may stay
+	// silent while a command awaits its response (IDLE excepted),
+	// and WriteTimeout how long a write may take.  They need the
+	// connection given to New to support deadlines, as a net.Conn
+	// does.  Running over fails the connection with ErrTimeout.
+	ReadTimeout, WriteTimeout time.Duration
 
-	Unsolicited chan interface{}
+	// CommandTimeout, if positive, limits how long a command (IDLE
+	// excepted) may take to complete.  Running over fails the
+	// command and the connection with ErrTimeout, since what the
+	// server made of the command is then unknown.
+	CommandTimeout time.Duration
+
+	// DisableRev2 keeps the connection on IMAP4rev1 even if the
+	// server offers IMAP4rev2, which is otherwise enabled once
+	// authenticated; see Version.
+	DisableRev2 bool
 
 	// Background thread.
 	r *reader
 	w io.Writer
 
+	// closer is w, or failing that r, if it can be closed; conn is
+	// w, or r, if it supports deadlines.
+	closer io.Closer
+	conn   deadliner
+
+	// dead is closed when the connection fails.
+	dead chan struct{}
+
+	// pendingLock guards everything below; pendingCond is signalled
+	// whenever a command completes or the connection fails, for
+	// commands waiting to be sent.
 	pendingLock sync.Mutex
-	pendingTag  tag
-	pendingChan chan interface{}
+	pendingCond *sync.Cond
+	nextTag     int
+	pending     []*command
+
+	state State
+	err   error
+
+	// lastActive is when a command was last sent or completed.
+	lastActive time.Time
+
+	// writeLock serialises writes; commands are written in tag order,
+	// the order in which send checked them against the pending ones.
+	writeLock sync.Mutex
+	writeCond *sync.Cond
+	nextWrite int
+
+	handlers handlers
+	mailbox  MailboxState
+	caps     capCache
 }
 
 func New(r io.Reader, w io.Writer) *IMAP {
-	return &IMAP{
-		r: &reader{newParser(r)},
-		w: w,
+	imap := &IMAP{
+		r:    &reader{newParser(r)},
+		w:    w,
+		dead: make(chan struct{}),
+	}
+	imap.pendingCond = sync.NewCond(&imap.pendingLock)
+	imap.writeCond = sync.NewCond(&imap.writeLock)
+	if c, ok := w.(io.Closer); ok {
+		imap.closer = c
+	} else if c, ok := r.(io.Closer); ok {
+		imap.closer = c
+	}
+	if c, ok := w.(deadliner); ok {
+		imap.conn = c
+	} else if c, ok := r.(deadliner); ok {
+		imap.conn = c
 	}
+	return imap
 }
 
 func (imap *IMAP) Start() (string, error) {
+	switch {
+	case imap.MaxLineLength > 0:
+		imap.r.maxLine = imap.MaxLineLength
+	case imap.MaxLineLength < 0:
+		imap.r.maxLine = 0
+	}
+	switch {
+	case imap.MaxLiteralLength > 0:
+		imap.r.maxLiteral = imap.MaxLiteralLength
+	case imap.MaxLiteralLength < 0:
+		imap.r.maxLiteral = 0
+	}
+
 	tag, r, err := imap.r.readResponse()
 	if err != nil {
 		return "", err
@@ -44,99 +176,329 @@ func (imap *IMAP) Start() (string, error) {
 	if tag != untagged {
 		return "", fmt.Errorf("expected untagged server hello. got %q", tag)
 	}
-	resp := r.(*ResponseStatus)
-	if resp.Status != OK {
-		return "", &IMAPError{resp.Status, resp.Text}
+
+	var text string
+	switch resp := r.(type) {
+	case *ResponseStatus:
+		if resp.Status != OK {
+			return "", &IMAPError{resp.Status, resp.Text, resp.Code}
+		}
+		text = resp.Text
+	case *ResponsePreauth:
+		text = resp.Text
+		imap.setState(StateAuthenticated)
+		imap.learn(resp.Code)
+	case *ResponseCapabilities:
+		// An OK greeting with a CAPABILITY code.
+		imap.learn(resp)
+	case *ResponseBye:
+		err := &ErrServerBye{resp.Code, resp.Text}
+		imap.fail(err)
+		return "", err
+	default:
+		// An OK greeting with a response code we parse into its own
+		// type; the text is lost, but it's a greeting all the same.
 	}
 
 	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				imap.pendingLock.Lock()
-				imap.pendingTag = 0
-				close(imap.pendingChan)
-				imap.pendingLock.Unlock()
-			}
-		}()
-
-		imap.readLoop()
+		var err error
+		defer func() { imap.fail(err) }()
+		defer recoverError(&err)
+		err = imap.readLoop()
 	}()
+	if imap.KeepAlive > 0 {
+		imap.pendingLock.Lock()
+		imap.lastActive = time.Now()
+		imap.pendingLock.Unlock()
+		go imap.keepAlive()
+	}
+	if _, ok := r.(*ResponsePreauth); ok {
+		if err := imap.upgrade(context.Background()); err != nil {
+			return text, err
+		}
+	}
 
-	return resp.Text, nil
+	return text, nil
 }
 
-func (imap *IMAP) Send(ch chan interface{}, format string, args ...interface{}) error {
-	tag := tag(imap.nextTag)
-	imap.nextTag++
+// State returns the current state of the connection.
+func (imap *IMAP) State() State {
+	imap.pendingLock.Lock()
+	defer imap.pendingLock.Unlock()
+	return imap.state
+}
 
-	toSend := []byte(fmt.Sprintf("a%d %s\r\n", int(tag), fmt.Sprintf(format, args...)))
+func (imap *IMAP) setState(state State) {
+	imap.pendingLock.Lock()
+	imap.state = state
+	imap.pendingLock.Unlock()
+}
 
-	if ch != nil {
-		imap.pendingLock.Lock()
-		imap.pendingTag = tag
-		imap.pendingChan = ch
-		imap.pendingLock.Unlock()
+// Err returns the reason the connection stopped working: an
+// *ErrServerBye, ErrLoggedOut or a read or write error.  It returns
+// nil while the connection is usable.
+func (imap *IMAP) Err() error {
+	imap.pendingLock.Lock()
+	defer imap.pendingLock.Unlock()
+	return imap.err
+}
+
+// fail marks the connection as dead and fails the pending commands.
+func (imap *IMAP) fail(err error) {
+	if isTimeout(err) {
+		err = ErrTimeout
+	}
+	imap.pendingLock.Lock()
+	defer imap.pendingLock.Unlock()
+	if imap.err == nil {
+		imap.err = err
+		close(imap.dead)
+	}
+	imap.state = StateLogout
+	for _, cmd := range imap.pending {
+		cmd.finish(nil)
+	}
+	imap.pending = nil
+	imap.pendingCond.Broadcast()
+}
+
+// Close closes the connection without logging out.  Pending commands
+// fail, and later ones fail with ErrClosed.
+func (imap *IMAP) Close() error {
+	imap.fail(ErrClosed)
+	if imap.closer == nil {
+		return nil
 	}
+	return imap.closer.Close()
+}
 
-	_, err := imap.w.Write(toSend)
+// Send sends a command.  The responses to it are sent to ch, ending
+// with its tagged *ResponseStatus, after which ch is closed; ch is
+// closed without a status if the connection fails first.  Untagged
+// data that isn't a response to any pending command goes to the
+// handlers registered with AddHandler.
+//
+// Several commands may be in flight at once.  Send blocks until the
+// command can be sent without making responses ambiguous; see doc.go.
+func (imap *IMAP) Send(ch chan interface{}, format string, args ...interface{}) error {
+	return imap.SendContext(context.Background(), ch, format, args...)
+}
+
+// SendContext is Send with a context governing the wait until the
+// command can be sent.
+func (imap *IMAP) SendContext(ctx context.Context, ch chan interface{}, format string, args ...interface{}) error {
+	_, err := imap.send(ctx, ch, fmt.Sprintf(format, args...))
 	return err
 }
 
-func (imap *IMAP) SendSync(format string, args ...interface{}) (*ResponseStatus, error) {
-	ch := make(chan interface{}, 1)
-	err := imap.Send(ch, format, args...)
+func (imap *IMAP) send(ctx context.Context, ch chan interface{}, text string) (*command, error) {
+	return imap.issue(ctx, newCommand(text, ch), text)
+}
+
+// issue waits until cmd can be sent without ambiguity and sends it.
+func (imap *IMAP) issue(ctx context.Context, cmd *command, text string) (*command, error) {
+	// Wake up the wait below if ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		imap.pendingLock.Lock()
+		imap.pendingCond.Broadcast()
+		imap.pendingLock.Unlock()
+	})
+	imap.pendingLock.Lock()
+	for imap.err == nil && ctx.Err() == nil && imap.blocked(cmd) {
+		imap.pendingCond.Wait()
+	}
+	stop()
+	err := imap.err
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		imap.pendingLock.Unlock()
+		cmd.finish(nil)
 		return nil, err
 	}
+	cmd.tag = tag(imap.nextTag)
+	imap.nextTag++
+	imap.started(cmd)
+	imap.pending = append(imap.pending, cmd)
+	switch cmd.name {
+	case "SELECT", "EXAMINE":
+		// Everything from here on is about the new mailbox.
+		imap.mailbox.reset(mailboxArg(text), cmd.name == "EXAMINE")
+	case "LOGIN", "AUTHENTICATE", "STARTTLS":
+		// The capabilities may change; the server usually says how.
+		imap.caps.reset()
+	}
+	imap.pendingLock.Unlock()
 
-	var response *ResponseStatus
-	extra := make([]interface{}, 0)
-L:
-	for {
-		r, open := <-ch
-		if !open {
-			return nil, errors.New("read failure")
+	imap.writeLock.Lock()
+	for imap.nextWrite != int(cmd.tag) {
+		imap.writeCond.Wait()
+	}
+	imap.writeDeadline()
+	_, err = fmt.Fprintf(imap.w, "a%d %s\r\n", int(cmd.tag), text)
+	imap.nextWrite++
+	imap.writeCond.Broadcast()
+	imap.writeLock.Unlock()
+
+	if err != nil {
+		// We can't know how much of the command the server got.
+		imap.fail(err)
+		return nil, imap.Err()
+	}
+	return cmd, nil
+}
+
+// issueLiterals sends a command whose text is split after each
+// synchronizing literal: each part but the last ends with "{n}", and
+// the next goes only once the server says to go ahead.  The command
+// has the connection to itself meanwhile, so that the go-ahead is its
+// and nothing else is written in between.  If the server refuses a
+// literal, the command completes and the rest isn't sent.
+//
+// If ctx is done while waiting, the command is abandoned, but the
+// server is owed the rest of it: that still goes out as the server
+// asks for it, so that the connection stays usable.
+func (imap *IMAP) issueLiterals(ctx context.Context, cmd *command, parts []string) error {
+	if len(parts) > 1 {
+		cmd.rule.exclusive = true
+		cmd.cont = make(chan struct{}, 1)
+	}
+	if _, err := imap.issue(ctx, cmd, parts[0]); err != nil {
+		return err
+	}
+	for rest := parts[1:]; len(rest) > 0; rest = rest[1:] {
+		select {
+		case <-cmd.cont:
+		case <-cmd.finished:
+			return nil
+		case <-ctx.Done():
+			imap.abandon(cmd)
+			go imap.writeLiterals(cmd, rest)
+			return ctx.Err()
 		}
+		if err := imap.write(rest[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		switch r := r.(type) {
-		case *ResponseStatus:
-			response = r
-			break L
-		default:
-			extra = append(extra, r)
+// writeLiterals sends the rest of an abandoned command of
+// issueLiterals, each part when the server says to go ahead.
+func (imap *IMAP) writeLiterals(cmd *command, rest []string) {
+	for _, part := range rest {
+		select {
+		case <-cmd.cont:
+		case <-cmd.finished:
+			return
+		}
+		if imap.write(part) != nil {
+			return
 		}
 	}
+}
 
-	if len(extra) > 0 {
-		response.Extra = extra
+// blocked reports whether cmd has to wait for a pending command.
+// Called with pendingLock held.
+func (imap *IMAP) blocked(cmd *command) bool {
+	for _, other := range imap.pending {
+		if cmd.conflicts(other) {
+			return true
+		}
 	}
-	// XXX callers discard unsolicited responses if this is not OK
-	if response.Status != OK {
-		return response, &IMAPError{response.Status, response.Text}
+	return false
+}
+
+// write writes a line that isn't a command, like IDLE's DONE.
+func (imap *IMAP) write(line string) error {
+	imap.writeLock.Lock()
+	imap.writeDeadline()
+	_, err := io.WriteString(imap.w, line+"\r\n")
+	imap.writeLock.Unlock()
+	if err != nil {
+		imap.fail(err)
+		return imap.Err()
 	}
-	return response, nil
+	return nil
+}
+
+// abandon gives up on a command whose caller has gone away.
+func (imap *IMAP) abandon(cmd *command) {
+	if !cmd.abandon() {
+		// It completed anyway.
+		return
+	}
+	switch cmd.name {
+	case "IDLE":
+		imap.write("DONE")
+	case "AUTHENTICATE":
+		imap.write("*")
+	}
+}
+
+func (imap *IMAP) SendSync(format string, args ...interface{}) (*ResponseStatus, error) {
+	return imap.SendSyncContext(context.Background(), format, args...)
+}
+
+// SendSyncContext is SendSync with a context; see IMAP for what
+// cancellation does.
+func (imap *IMAP) SendSyncContext(ctx context.Context, format string, args ...interface{}) (*ResponseStatus, error) {
+	c, err := imap.SendAsyncContext(ctx, format, args...)
+	if err != nil {
+		return nil, err
+	}
+	// XXX callers discard unsolicited responses if this is not OK
+	return c.wait(ctx)
 }
 
 func (imap *IMAP) Auth(user string, pass string) (string, []string, error) {
-	resp, err := imap.SendSync("LOGIN %s %s", user, pass)
+	return imap.AuthContext(context.Background(), user, pass)
+}
+
+func (imap *IMAP) AuthContext(ctx context.Context, user string, pass string) (string, []string, error) {
+	c, err := imap.AuthAsyncContext(ctx, user, pass)
+	if err != nil {
+		return "", nil, err
+	}
+	resp, err := c.wait(ctx)
 	if err != nil {
 		return "", nil, err
 	}
 
 	var caps []string
+	if code, ok := resp.Code.(*ResponseCapabilities); ok {
+		caps = code.Capabilities
+	}
 	for _, extra := range resp.Extra {
 		switch extra := extra.(type) {
 		case *ResponseCapabilities:
 			caps = extra.Capabilities
 		default:
-			imap.Unsolicited <- extra
+			imap.unsolicited(extra)
 		}
 	}
-	return resp.Text, caps, nil
+	return resp.Text, caps, imap.upgrade(ctx)
+}
+
+func (imap *IMAP) AuthAsync(user string, pass string) (*Command, error) {
+	return imap.AuthAsyncContext(context.Background(), user, pass)
+}
+
+func (imap *IMAP) AuthAsyncContext(ctx context.Context, user string, pass string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "LOGIN %s %s", user, pass)
 }
 
 func (imap *IMAP) Capability() ([]string, error) {
-	resp, err := imap.SendSync("CAPABILITY")
+	return imap.CapabilityContext(context.Background())
+}
+
+func (imap *IMAP) CapabilityContext(ctx context.Context) ([]string, error) {
+	c, err := imap.CapabilityAsyncContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -151,28 +513,91 @@ func (imap *IMAP) Capability() ([]string, error) {
 	panic("Didn't get CAPABILITY reply from the server!")
 }
 
-func (imap *IMAP) Idle() (chan interface{}, error) {
-	ch := make(chan interface{})
-	err := imap.Send(ch, "IDLE")
+func (imap *IMAP) CapabilityAsync() (*Command, error) {
+	return imap.CapabilityAsyncContext(context.Background())
+}
 
-	return ch, err
+func (imap *IMAP) CapabilityAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "CAPABILITY")
 }
 
-func (imap *IMAP) Done() (error) {
-	_, err := imap.w.Write([]byte("DONE\r\n"))
+// Noop does nothing, giving the server the chance to report changes
+// to the mailbox; what it reports goes to the handlers.
+func (imap *IMAP) Noop() error {
+	return imap.NoopContext(context.Background())
+}
+
+func (imap *IMAP) NoopContext(ctx context.Context) error {
+	c, err := imap.NoopAsyncContext(ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+	for _, extra := range resp.Extra {
+		imap.unsolicited(extra)
+	}
+	return nil
+}
+
+// NoopAsync is Noop without the wait.  What the server reports is the
+// Command's, not the handlers'.
+func (imap *IMAP) NoopAsync() (*Command, error) {
+	return imap.NoopAsyncContext(context.Background())
+}
+
+func (imap *IMAP) NoopAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "NOOP")
+}
+
+// Logout ends the session.  The server's BYE in reply is expected and
+// not treated as an error; afterwards every command fails with
+// ErrLoggedOut.
+func (imap *IMAP) Logout() error {
+	return imap.LogoutContext(context.Background())
+}
+
+func (imap *IMAP) LogoutContext(ctx context.Context) error {
+	c, err := imap.LogoutAsyncContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.wait(ctx)
 	return err
 }
 
+func (imap *IMAP) LogoutAsync() (*Command, error) {
+	return imap.LogoutAsyncContext(context.Background())
+}
+
+func (imap *IMAP) LogoutAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "LOGOUT")
+}
+
+// quote returns a string as an IMAP quoted string, escaping '"' and
+// '\'.
 func quote(in string) string {
 	if strings.IndexAny(in, "\r\n") >= 0 {
 		panic("invalid characters in string to quote")
 	}
-	return "\"" + in + "\""
+	return "\"" + quoteReplacer.Replace(in) + "\""
 }
 
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 func (imap *IMAP) List(reference string, name string) ([]*ResponseList, error) {
+	return imap.ListContext(context.Background(), reference, name)
+}
+
+func (imap *IMAP) ListContext(ctx context.Context, reference string, name string) ([]*ResponseList, error) {
 	/* Responses:  untagged responses: LIST */
-	response, err := imap.SendSync("LIST %s %s", quote(reference), quote(name))
+	c, err := imap.ListAsyncContext(ctx, reference, name)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -182,30 +607,145 @@ func (imap *IMAP) List(reference string, name string) ([]*ResponseList, error) {
 		if list, ok := extra.(*ResponseList); ok {
 			lists = append(lists, list)
 		} else {
-			imap.Unsolicited <- extra
+			imap.unsolicited(extra)
 		}
 	}
 
 	return lists, nil
 }
 
+func (imap *IMAP) ListAsync(reference string, name string) (*Command, error) {
+	return imap.ListAsyncContext(context.Background(), reference, name)
+}
+
+func (imap *IMAP) ListAsyncContext(ctx context.Context, reference string, name string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "LIST %s %s", quote(reference), quote(name))
+}
+
+// Status asks for the given items (MESSAGES, UIDNEXT, UNSEEN,
+// HIGHESTMODSEQ, ...) of a mailbox without selecting it.
+func (imap *IMAP) Status(mailbox string, items ...string) (*ResponseMailboxStatus, error) {
+	return imap.StatusContext(context.Background(), mailbox, items...)
+}
+
+func (imap *IMAP) StatusContext(ctx context.Context, mailbox string, items ...string) (*ResponseMailboxStatus, error) {
+	c, err := imap.StatusAsyncContext(ctx, mailbox, items...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var status *ResponseMailboxStatus
+	for _, extra := range resp.Extra {
+		// Under NOTIFY, other mailboxes' STATUS may come first.
+		if s, ok := extra.(*ResponseMailboxStatus); ok && status == nil && sameMailbox(s.Mailbox, mailbox) {
+			status = s
+		} else {
+			imap.unsolicited(extra)
+		}
+	}
+	if status == nil {
+		return nil, fmt.Errorf("imap: no STATUS response for %q", mailbox)
+	}
+	return status, nil
+}
+
+func (imap *IMAP) StatusAsync(mailbox string, items ...string) (*Command, error) {
+	return imap.StatusAsyncContext(context.Background(), mailbox, items...)
+}
+
+func (imap *IMAP) StatusAsyncContext(ctx context.Context, mailbox string, items ...string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "STATUS %s (%s)", quote(mailbox), strings.Join(items, " "))
+}
+
 // ResponseExamine contains the response to examining a mailbox.
 type ResponseExamine struct {
-	Flags          []string
+	Flags          Flags
 	Exists         int
-	Recent         int
-	PermanentFlags []string
+	Recent         int // always 0 under IMAP4rev2, which has no RECENT
+	PermanentFlags Flags
 	UIDValidity    int
 	UIDNext        int
+
+	// HighestModSeq is reported by CONDSTORE servers, unless the
+	// mailbox doesn't support mod-sequences (NoModSeq).
+	HighestModSeq uint64
+	NoModSeq      bool
+
+	// With SelectQResync, Vanished is the set of the UIDs expunged
+	// since, and Changed has the messages changed since.
+	Vanished string
+	Changed  []*ResponseFetch
+}
+
+func (imap *IMAP) Examine(mailbox string, opts ...SelectOption) (*ResponseExamine, error) {
+	return imap.ExamineContext(context.Background(), mailbox, opts...)
+}
+
+func (imap *IMAP) ExamineContext(ctx context.Context, mailbox string, opts ...SelectOption) (*ResponseExamine, error) {
+	return imap.selectMailbox(ctx, "EXAMINE", mailbox, opts)
+}
+
+// Select selects a mailbox read-write.  The state of the selected
+// mailbox is tracked by Mailbox.
+func (imap *IMAP) Select(mailbox string, opts ...SelectOption) (*ResponseExamine, error) {
+	return imap.SelectContext(context.Background(), mailbox, opts...)
+}
+
+func (imap *IMAP) SelectContext(ctx context.Context, mailbox string, opts ...SelectOption) (*ResponseExamine, error) {
+	return imap.selectMailbox(ctx, "SELECT", mailbox, opts)
+}
+
+// SelectAsync and ExamineAsync leave the responses, which update
+// Mailbox as usual, in the Command.
+func (imap *IMAP) SelectAsync(mailbox string, opts ...SelectOption) (*Command, error) {
+	return imap.SelectAsyncContext(context.Background(), mailbox, opts...)
+}
+
+func (imap *IMAP) SelectAsyncContext(ctx context.Context, mailbox string, opts ...SelectOption) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "%s", formatSelect("SELECT", mailbox, opts))
+}
+
+func (imap *IMAP) ExamineAsync(mailbox string, opts ...SelectOption) (*Command, error) {
+	return imap.ExamineAsyncContext(context.Background(), mailbox, opts...)
+}
+
+func (imap *IMAP) ExamineAsyncContext(ctx context.Context, mailbox string, opts ...SelectOption) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "%s", formatSelect("EXAMINE", mailbox, opts))
+}
+
+func formatSelect(command, mailbox string, opts []SelectOption) string {
+	text := command + " " + quote(mailbox)
+	if len(opts) > 0 {
+		params := make([]string, len(opts))
+		for i, opt := range opts {
+			params[i] = string(opt)
+		}
+		text += " (" + strings.Join(params, " ") + ")"
+	}
+	return text
 }
 
-func (imap *IMAP) Examine(mailbox string) (*ResponseExamine, error) {
+func (imap *IMAP) selectMailbox(ctx context.Context, command, mailbox string, opts []SelectOption) (*ResponseExamine, error) {
 	/*
 	 Responses:  REQUIRED untagged responses: FLAGS, EXISTS, RECENT
 	 REQUIRED OK untagged responses:  UNSEEN,  PERMANENTFLAGS,
 	 UIDNEXT, UIDVALIDITY
 	*/
-	resp, err := imap.SendSync("EXAMINE %s", quote(mailbox))
+	var c *Command
+	var err error
+	if command == "EXAMINE" {
+		c, err = imap.ExamineAsyncContext(ctx, mailbox, opts...)
+	} else {
+		c, err = imap.SelectAsyncContext(ctx, mailbox, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -229,25 +769,59 @@ func (imap *IMAP) Examine(mailbox string) (*ResponseExamine, error) {
 		case (*ResponseUIDValidity):
 			value := extra.Value
 			r.UIDValidity = value
+		case (*ResponseHighestModSeq):
+			r.HighestModSeq = extra.Value
+		case (*ResponseStatus):
+			if extra.Code == "NOMODSEQ" {
+				r.NoModSeq = true
+			} else {
+				imap.unsolicited(extra)
+			}
+		case (*ResponseVanished):
+			if !extra.Earlier {
+				imap.unsolicited(extra)
+			} else if r.Vanished == "" {
+				r.Vanished = extra.Set
+			} else {
+				r.Vanished += "," + extra.Set
+			}
+		case (*ResponseFetch):
+			r.Changed = append(r.Changed, extra)
 		default:
-			imap.Unsolicited <- extra
+			imap.unsolicited(extra)
 		}
 	}
 	return r, nil
 }
 
-func formatFetch(sequence string, fields []string) string {
+func formatFetch(sequence string, fields []string, mods []FetchModifier) string {
 	var fieldsStr string
 	if len(fields) == 1 {
 		fieldsStr = fields[0]
 	} else {
 		fieldsStr = "(" + strings.Join(fields, " ") + ")"
 	}
-	return fmt.Sprintf("FETCH %s %s", sequence, fieldsStr)
+	text := fmt.Sprintf("FETCH %s %s", sequence, fieldsStr)
+	if len(mods) > 0 {
+		strs := make([]string, len(mods))
+		for i, mod := range mods {
+			strs[i] = string(mod)
+		}
+		text += " (" + strings.Join(strs, " ") + ")"
+	}
+	return text
 }
 
-func (imap *IMAP) Fetch(sequence string, fields []string) ([]*ResponseFetch, error) {
-	resp, err := imap.SendSync("%s", formatFetch(sequence, fields))
+func (imap *IMAP) Fetch(sequence string, fields []string, mods ...FetchModifier) ([]*ResponseFetch, error) {
+	return imap.FetchContext(context.Background(), sequence, fields, mods...)
+}
+
+func (imap *IMAP) FetchContext(ctx context.Context, sequence string, fields []string, mods ...FetchModifier) ([]*ResponseFetch, error) {
+	c, err := imap.FetchAsyncContext(ctx, sequence, fields, mods...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -257,102 +831,334 @@ func (imap *IMAP) Fetch(sequence string, fields []string) ([]*ResponseFetch, err
 		if list, ok := extra.(*ResponseFetch); ok {
 			lists = append(lists, list)
 		} else {
-			imap.Unsolicited <- extra
+			imap.unsolicited(extra)
 		}
 	}
 	return lists, nil
 }
 
-func (imap *IMAP) FetchAsync(sequence string, fields []string) (chan interface{}, error) {
-	ch := make(chan interface{})
-	err := imap.Send(ch, formatFetch(sequence, fields))
+// FetchAsync is Fetch without the wait; the messages can be read
+// from the Command's Responses as they arrive.
+func (imap *IMAP) FetchAsync(sequence string, fields []string, mods ...FetchModifier) (*Command, error) {
+	return imap.FetchAsyncContext(context.Background(), sequence, fields, mods...)
+}
+
+func (imap *IMAP) FetchAsyncContext(ctx context.Context, sequence string, fields []string, mods ...FetchModifier) (*Command, error) {
+	if imap.Version() == IMAP4rev2 {
+		fields = rev2FetchItems(fields)
+	}
+	return imap.SendAsyncContext(ctx, "%s", formatFetch(sequence, fields, mods))
+}
+
+// StoreItem says how Store changes the flags of messages.
+type StoreItem string
+
+const (
+	StoreReplace StoreItem = "FLAGS"
+	StoreAdd     StoreItem = "+FLAGS"
+	StoreRemove  StoreItem = "-FLAGS"
+
+	// The silent variants suppress the FETCH responses with the
+	// messages' new flags.
+	StoreReplaceSilent StoreItem = "FLAGS.SILENT"
+	StoreAddSilent     StoreItem = "+FLAGS.SILENT"
+	StoreRemoveSilent  StoreItem = "-FLAGS.SILENT"
+)
+
+// Store changes the flags of the messages in sequence, returning the
+// messages' updated flags unless a silent item was used.  With
+// UnchangedSince, messages modified since are left alone and reported
+// by a *ModifiedError, alongside the results for the others.
+func (imap *IMAP) Store(sequence string, item StoreItem, flags Flags, mods ...StoreModifier) ([]*ResponseFetch, error) {
+	return imap.StoreContext(context.Background(), sequence, item, flags, mods...)
+}
+
+func (imap *IMAP) StoreContext(ctx context.Context, sequence string, item StoreItem, flags Flags, mods ...StoreModifier) ([]*ResponseFetch, error) {
+	c, err := imap.StoreAsyncContext(ctx, sequence, item, flags, mods...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Stream all responses to this message into outChan, and everything
-	// else into unsolicited.
-	outChan := make(chan interface{})
-	go func() {
-		for {
-			r := <-ch
-			switch r := r.(type) {
-			case *ResponseFetch:
-				outChan <- r
-			case *ResponseStatus:
-				outChan <- r
-				return
-			default:
-				imap.Unsolicited <- r
-			}
+	lists := make([]*ResponseFetch, 0)
+	for _, extra := range resp.Extra {
+		if list, ok := extra.(*ResponseFetch); ok {
+			lists = append(lists, list)
+		} else {
+			imap.unsolicited(extra)
 		}
-	}()
-	return outChan, nil
+	}
+	if modified, ok := resp.Code.(*ResponseModified); ok {
+		return lists, &ModifiedError{modified.Messages}
+	}
+	return lists, nil
+}
+
+func (imap *IMAP) StoreAsync(sequence string, item StoreItem, flags Flags, mods ...StoreModifier) (*Command, error) {
+	return imap.StoreAsyncContext(context.Background(), sequence, item, flags, mods...)
+}
+
+func (imap *IMAP) StoreAsyncContext(ctx context.Context, sequence string, item StoreItem, flags Flags, mods ...StoreModifier) (*Command, error) {
+	text := "STORE " + sequence
+	if len(mods) > 0 {
+		strs := make([]string, len(mods))
+		for i, mod := range mods {
+			strs[i] = string(mod)
+		}
+		text += " (" + strings.Join(strs, " ") + ")"
+	}
+	return imap.SendAsyncContext(ctx, "%s %s %s", text, item, flags)
 }
 
 // Repeatedly reads messages off the connection and dispatches them.
 func (imap *IMAP) readLoop() error {
-	var msgChan chan interface{}
 	for {
 		tag, r, err := imap.r.readResponse()
-		check(err)
+		if err != nil {
+			return err
+		}
 
-		if msgChan == nil {
+		if tag == untagged {
 			imap.pendingLock.Lock()
-			msgChan = imap.pendingChan
+			imap.readDeadline()
 			imap.pendingLock.Unlock()
+			if err := imap.dispatch(r); err != nil {
+				return err
+			}
+			continue
 		}
 
-		if tag == untagged {
-			if msgChan != nil {
-				msgChan <- r
-			} else {
-				imap.Unsolicited <- r
+		resp := r.(*ResponseStatus)
+		imap.pendingLock.Lock()
+		var cmd *command
+		for i, p := range imap.pending {
+			if p.tag == tag {
+				cmd = p
+				imap.pending = append(imap.pending[:i], imap.pending[i+1:]...)
+				break
+			}
+		}
+		if cmd != nil {
+			imap.transition(cmd, resp)
+			imap.lastActive = time.Now()
+		}
+		imap.readDeadline()
+		imap.pendingCond.Broadcast()
+		imap.pendingLock.Unlock()
+
+		if cmd == nil {
+			return fmt.Errorf("unexpected response tag %d", tag)
+		}
+		cmd.finish(resp)
+		imap.alert(resp)
+		if cmd.name == "LOGOUT" && resp.Status == OK {
+			return ErrLoggedOut
+		}
+	}
+}
+
+// transition updates the connection state for a completed command.
+// This is done here rather than by the caller, which may have
+// abandoned the command.  Called with pendingLock held.
+func (imap *IMAP) transition(cmd *command, resp *ResponseStatus) {
+	if resp.Status == OK {
+		imap.learn(resp.Code)
+		imap.mailbox.apply(resp.Code)
+	}
+	switch cmd.name {
+	case "LOGIN", "AUTHENTICATE":
+		if resp.Status == OK {
+			imap.state = StateAuthenticated
+		}
+	case "SELECT", "EXAMINE":
+		if resp.Status == OK {
+			imap.state = StateSelected
+			switch resp.Code {
+			case "READ-ONLY":
+				imap.mailbox.setReadOnly(true)
+			case "READ-WRITE":
+				imap.mailbox.setReadOnly(false)
 			}
 		} else {
-			resp := r.(*ResponseStatus)
+			// A failed SELECT deselects the current mailbox.
+			imap.state = StateAuthenticated
+			imap.mailbox.reset("", false)
+		}
+	case "CLOSE", "UNSELECT":
+		if resp.Status == OK {
+			imap.state = StateAuthenticated
+			imap.mailbox.reset("", false)
+		}
+	}
+}
 
-			imap.pendingLock.Lock()
-			if imap.pendingTag != tag {
-				return fmt.Errorf("expected response tag %s, got %s", imap.pendingTag, tag)
+// dispatch hands an untagged response to the pending command it
+// belongs to, or to the handlers.
+func (imap *IMAP) dispatch(r interface{}) error {
+	if bye, ok := r.(*ResponseBye); ok {
+		// Whether expected or not, the handlers hear about it.
+		imap.unsolicited(bye)
+
+		imap.pendingLock.Lock()
+		imap.state = StateLogout
+		expected := len(imap.pending) > 0 && imap.pending[0].name == "LOGOUT"
+		imap.pendingLock.Unlock()
+		if !expected {
+			return &ErrServerBye{bye.Code, bye.Text}
+		}
+	}
+
+	imap.mailbox.apply(r)
+	imap.learn(r)
+
+	imap.pendingLock.Lock()
+	cmd := imap.route(r)
+	imap.pendingLock.Unlock()
+
+	if _, ok := r.(*ResponseContinuation); ok && cmd != nil && cmd.cont != nil {
+		select {
+		case cmd.cont <- struct{}{}:
+		default:
+		}
+	} else if cmd != nil && cmd.wantsData() {
+		cmd.deliver(r)
+	} else {
+		imap.unsolicited(r)
+	}
+	return nil
+}
+
+// route returns the pending command an untagged response belongs to,
+// or nil if it's unsolicited.  Called with pendingLock held.
+func (imap *IMAP) route(r interface{}) *command {
+	kind := responseKind(r)
+	if kind == "+" {
+		// Only the last command sent can be waiting to continue.
+		if n := len(imap.pending); n > 0 {
+			return imap.pending[n-1]
+		}
+		return nil
+	}
+
+	if esearch, ok := r.(*ResponseESearch); ok && esearch.Tag != "" {
+		// ESEARCH says which command it answers.
+		for _, cmd := range imap.pending {
+			if fmt.Sprintf("a%d", int(cmd.tag)) == esearch.Tag {
+				return cmd
 			}
-			imap.pendingChan = nil
-			imap.pendingLock.Unlock()
+		}
+	}
 
-			msgChan <- resp
-			msgChan = nil
+	var fallback *command
+	for _, cmd := range imap.pending {
+		if cmd.rule.exclusive {
+			if cmd.rule.passive {
+				return nil
+			}
+			return cmd
+		}
+		if kind != "" && cmd.wants(kind) {
+			if fetch, ok := r.(*ResponseFetch); !ok || cmd.owns(fetch) {
+				return cmd
+			}
+		}
+		if cmd.rule.all && fallback == nil {
+			fallback = cmd
 		}
 	}
-	panic("not reached")
+	return fallback
 }
 
+// Address is an address from a message envelope.  Name is the
+// display name with RFC 2047 encoded words decoded; RawName is the
+// name as sent by the server.
+//
+// An RFC 2822 group ("undisclosed-recipients:;") is a single Address
+// with Group set, Name holding the group's display name and Members
+// its addresses, if any.
 type Address struct {
 	Name, Source, Address string
+	RawName               string
+	Group                 bool
+	Members               []Address
 }
 
-func (a *Address) fromSexp(s []sexp) {
+// addressKind says what an envelope address structure represents.
+type addressKind int
+
+const (
+	addressMailbox addressKind = iota
+	addressGroupStart
+	addressGroupEnd
+)
+
+// fromSexp fills in the address from an envelope address structure.
+// Per RFC 3501, a NIL host marks group syntax: with a mailbox name it
+// starts a group (the mailbox name being the group's name), without
+// one it ends the group.
+func (a *Address) fromSexp(s []sexp) addressKind {
+	if len(s) != 4 {
+		panic(fmt.Errorf("address needed 4 fields, had %d", len(s)))
+	}
 	if name := nilOrString(s[0]); name != nil {
-		a.Name = *name
+		a.RawName = *name
+		a.Name = decodeHeader(*name)
 	}
 	if source := nilOrString(s[1]); source != nil {
 		a.Source = *source
 	}
 	mbox := nilOrString(s[2])
 	host := nilOrString(s[3])
-	if mbox != nil && host != nil {
-		address := *mbox + "@" + *host
-		a.Address = address
+	if host == nil {
+		if mbox == nil {
+			return addressGroupEnd
+		}
+		a.RawName = *mbox
+		a.Name = decodeHeader(*mbox)
+		a.Group = true
+		return addressGroupStart
 	}
+	if mbox != nil {
+		a.Address = *mbox + "@" + *host
+	}
+	return addressMailbox
 }
+
 func addressListFromSexp(s sexp) []Address {
 	if s == nil {
 		return nil
 	}
 
 	saddrs := s.([]sexp)
-	addrs := make([]Address, len(saddrs))
-	for i, s := range saddrs {
-		addrs[i].fromSexp(s.([]sexp))
+	addrs := make([]Address, 0, len(saddrs))
+	var group *Address
+	for _, s := range saddrs {
+		var addr Address
+		switch addr.fromSexp(s.([]sexp)) {
+		case addressGroupStart:
+			if group != nil {
+				addrs = append(addrs, *group)
+			}
+			group = &addr
+		case addressGroupEnd:
+			if group != nil {
+				addrs = append(addrs, *group)
+				group = nil
+			}
+		default:
+			if group != nil {
+				group.Members = append(group.Members, addr)
+			} else {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if group != nil {
+		// Unterminated group; keep what we have.
+		addrs = append(addrs, *group)
 	}
 	return addrs
 }
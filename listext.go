@@ -0,0 +1,173 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ListOptions are the options of an extended LIST (RFC 5258).
+type ListOptions struct {
+	// Selection options.  Subscribed lists the subscribed mailboxes,
+	// whether they exist or not; Remote adds mailboxes on other
+	// servers; RecursiveMatch, with Subscribed, also lists parents
+	// of matches with ChildInfo set; SpecialUse lists only the
+	// special-use mailboxes (RFC 6154).
+	Subscribed, Remote, RecursiveMatch, SpecialUse bool
+
+	// Return options, asking for \HasChildren or \HasNoChildren,
+	// \Subscribed and the special-use attributes, and for the STATUS
+	// items (RFC 5819), such as MESSAGES and UNSEEN, of each
+	// selectable mailbox.
+	ReturnChildren, ReturnSubscribed, ReturnSpecialUse bool
+	ReturnStatus                                       []string
+}
+
+func (o ListOptions) selection() []string {
+	var opts []string
+	if o.Subscribed {
+		opts = append(opts, "SUBSCRIBED")
+	}
+	if o.Remote {
+		opts = append(opts, "REMOTE")
+	}
+	if o.RecursiveMatch {
+		opts = append(opts, "RECURSIVEMATCH")
+	}
+	if o.SpecialUse {
+		opts = append(opts, "SPECIAL-USE")
+	}
+	return opts
+}
+
+func (o ListOptions) returns(status bool) []string {
+	var opts []string
+	if o.ReturnChildren {
+		opts = append(opts, "CHILDREN")
+	}
+	if o.ReturnSubscribed {
+		opts = append(opts, "SUBSCRIBED")
+	}
+	if o.ReturnSpecialUse {
+		opts = append(opts, "SPECIAL-USE")
+	}
+	if status && len(o.ReturnStatus) > 0 {
+		opts = append(opts, "STATUS ("+strings.Join(o.ReturnStatus, " ")+")")
+	}
+	return opts
+}
+
+func formatListExtended(reference string, patterns []string, opts ListOptions, status bool) string {
+	text := "LIST "
+	if sel := opts.selection(); len(sel) > 0 {
+		text += "(" + strings.Join(sel, " ") + ") "
+	}
+	text += quote(reference) + " "
+	if len(patterns) == 1 {
+		text += quote(patterns[0])
+	} else {
+		quoted := make([]string, len(patterns))
+		for i, p := range patterns {
+			quoted[i] = quote(p)
+		}
+		text += "(" + strings.Join(quoted, " ") + ")"
+	}
+	if ret := opts.returns(status); len(ret) > 0 {
+		text += " RETURN (" + strings.Join(ret, " ") + ")"
+	}
+	return text
+}
+
+// ListExtended is List with several patterns and the options of
+// LIST-EXTENDED, so that one call can return the whole tree of
+// mailboxes with their attributes and unread counts.  There must be
+// at least one pattern.  If the server doesn't have LIST-STATUS, the
+// STATUS items are asked for mailbox by mailbox.
+func (imap *IMAP) ListExtended(reference string, patterns []string, opts ListOptions) ([]*ResponseList, error) {
+	return imap.ListExtendedContext(context.Background(), reference, patterns, opts)
+}
+
+func (imap *IMAP) ListExtendedContext(ctx context.Context, reference string, patterns []string, opts ListOptions) ([]*ResponseList, error) {
+	c, listStatus, err := imap.listExtended(ctx, reference, patterns, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lists := make([]*ResponseList, 0)
+	byName := make(map[string]*ResponseList)
+	var statuses []*ResponseMailboxStatus
+	for _, extra := range resp.Extra {
+		switch extra := extra.(type) {
+		case *ResponseList:
+			lists = append(lists, extra)
+			byName[extra.Name] = extra
+		case *ResponseMailboxStatus:
+			statuses = append(statuses, extra)
+		default:
+			imap.unsolicited(extra)
+		}
+	}
+	// The STATUS of a mailbox follows its LIST.
+	for _, status := range statuses {
+		if list, ok := byName[status.Mailbox]; ok {
+			list.Status = status.Items
+		} else {
+			imap.unsolicited(status)
+		}
+	}
+
+	if !listStatus && len(opts.ReturnStatus) > 0 {
+		if err := imap.listStatus(ctx, lists, opts.ReturnStatus); err != nil {
+			return nil, err
+		}
+	}
+	return lists, nil
+}
+
+func (imap *IMAP) ListExtendedAsync(reference string, patterns []string, opts ListOptions) (*Command, error) {
+	return imap.ListExtendedAsyncContext(context.Background(), reference, patterns, opts)
+}
+
+// ListExtendedAsyncContext is ListExtendedAsync with a context.  It
+// sends the command ListExtended would, so on a server without
+// LIST-STATUS the STATUS items are left out; they are then the
+// caller's to ask for.
+func (imap *IMAP) ListExtendedAsyncContext(ctx context.Context, reference string, patterns []string, opts ListOptions) (*Command, error) {
+	c, _, err := imap.listExtended(ctx, reference, patterns, opts)
+	return c, err
+}
+
+// listExtended sends an extended LIST, with the STATUS items if the
+// server has LIST-STATUS, which it reports.
+func (imap *IMAP) listExtended(ctx context.Context, reference string, patterns []string, opts ListOptions) (c *Command, listStatus bool, err error) {
+	if len(patterns) == 0 {
+		return nil, false, errors.New("imap: LIST of no patterns")
+	}
+	if len(opts.ReturnStatus) > 0 {
+		if listStatus, err = imap.supports(ctx, "LIST-STATUS"); err != nil {
+			return nil, false, err
+		}
+	}
+	c, err = imap.SendAsyncContext(ctx, "%s", formatListExtended(reference, patterns, opts, listStatus))
+	return c, listStatus, err
+}
+
+// listStatus stands in for LIST-STATUS with a STATUS per selectable
+// mailbox.
+func (imap *IMAP) listStatus(ctx context.Context, lists []*ResponseList, items []string) error {
+	for _, list := range lists {
+		if list.Selectable != nil && !*list.Selectable {
+			continue
+		}
+		status, err := imap.StatusContext(ctx, list.Name, items...)
+		if err != nil {
+			return err
+		}
+		list.Status = status.Items
+	}
+	return nil
+}
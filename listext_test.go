@@ -0,0 +1,94 @@
+package imap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListExtended(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var lists []*ResponseList
+	done := async(func() (err error) {
+		lists, err = imap.ListExtended("", []string{"*", "Shared/%"}, ListOptions{
+			Subscribed:       true,
+			RecursiveMatch:   true,
+			ReturnChildren:   true,
+			ReturnSpecialUse: true,
+			ReturnStatus:     []string{"MESSAGES", "UNSEEN"},
+		})
+		return err
+	})
+	// Whether STATUS can go in the LIST depends on the capabilities.
+	srv.expect("a0 CAPABILITY")
+	srv.send("* CAPABILITY IMAP4rev1 LIST-EXTENDED LIST-STATUS", "a0 OK done")
+	srv.expect(`a1 LIST (SUBSCRIBED RECURSIVEMATCH) "" ("*" "Shared/%") RETURN (CHILDREN SPECIAL-USE STATUS (MESSAGES UNSEEN))`)
+	srv.send(
+		`* LIST (\Subscribed \HasNoChildren) "/" "INBOX"`,
+		`* STATUS "INBOX" (MESSAGES 17 UNSEEN 16)`,
+		`* LIST (\Subscribed \Sent \HasNoChildren) "/" "Sent"`,
+		`* STATUS "Sent" (MESSAGES 4 UNSEEN 0)`,
+		`* LIST (\NonExistent \HasChildren) "/" "Shared" ("CHILDINFO" ("SUBSCRIBED"))`,
+		"a1 OK done",
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("ListExtended: %s", err)
+	}
+	if len(lists) != 3 {
+		t.Fatalf("got %d mailboxes, want 3", len(lists))
+	}
+	if got, want := lists[0].Status, map[string]uint64{"MESSAGES": 17, "UNSEEN": 16}; !reflect.DeepEqual(got, want) {
+		t.Errorf("INBOX status %v, want %v", got, want)
+	}
+	if use := lists[1].SpecialUse(); use != SpecialUseSent {
+		t.Errorf("Sent special use %q", use)
+	}
+	if !lists[1].HasAttribute(`\subscribed`) {
+		t.Errorf("Sent not subscribed")
+	}
+	shared := lists[2]
+	if *shared.Selectable || !*shared.Children || !reflect.DeepEqual(shared.ChildInfo, []string{"SUBSCRIBED"}) || shared.Status != nil {
+		t.Errorf("Shared: %#v", shared)
+	}
+
+	if _, err := imap.ListExtended("", nil, ListOptions{}); err == nil {
+		t.Errorf("ListExtended of no patterns succeeded")
+	}
+}
+
+func TestListStatusFallback(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 LIST-EXTENDED] ready")
+	var lists []*ResponseList
+	done := async(func() (err error) {
+		lists, err = imap.ListExtended("", []string{"%"}, ListOptions{ReturnStatus: []string{"UNSEEN"}})
+		return err
+	})
+	srv.expect(`a0 LIST "" "%"`)
+	srv.send(`* LIST () "/" "INBOX"`, `* LIST (\Noselect) "/" "Public"`, "a0 OK done")
+	srv.expect(`a1 STATUS "INBOX" (UNSEEN)`)
+	srv.send(`* STATUS "INBOX" (UNSEEN 2)`, "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("ListExtended: %s", err)
+	}
+	if len(lists) != 2 || lists[0].Status["UNSEEN"] != 2 || lists[1].Status != nil {
+		t.Errorf("got %#v", lists)
+	}
+}
+
+func TestListExtendedAsyncNoListStatus(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 LIST-EXTENDED] ready")
+	done := async(func() error {
+		c, err := imap.ListExtendedAsync("", []string{"%"}, ListOptions{ReturnStatus: []string{"UNSEEN"}})
+		if err != nil {
+			return err
+		}
+		_, err = c.Wait(context.Background())
+		return err
+	})
+	// The same command as ListExtended sends: no STATUS in the LIST.
+	srv.expect(`a0 LIST "" "%"`)
+	srv.send(`* LIST () "/" "INBOX"`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("ListExtendedAsync: %s", err)
+	}
+}
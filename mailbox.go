@@ -0,0 +1,338 @@
+package imap
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MailboxStatus is a snapshot of what is known about the selected
+// mailbox.
+type MailboxStatus struct {
+	// Name is empty when no mailbox is selected.
+	Name     string
+	ReadOnly bool
+
+	// Recent is always 0 under IMAP4rev2.
+	Exists, Recent        int
+	UIDValidity, UIDNext  int
+	Flags, PermanentFlags Flags
+	HighestModSeq         uint64
+}
+
+// MailboxState records the server data about the selected mailbox, as
+// RFC 3501 says a client should: the message counts, UIDVALIDITY and
+// friends, and the UIDs of messages by sequence number as far as
+// they've been seen in FETCH responses, renumbered on EXPUNGE.  It is
+// kept up to date by the client as data arrives, whether in response
+// to a command or unsolicited.
+type MailboxState struct {
+	mu     sync.Mutex
+	status MailboxStatus
+
+	// uids[seq-1] is the UID of message seq, or 0 if not known.
+	uids []int
+
+	subs []chan MailboxStatus
+}
+
+// Mailbox returns the state of the selected mailbox.  The same
+// MailboxState is used for each mailbox selected on the connection.
+func (imap *IMAP) Mailbox() *MailboxState {
+	return &imap.mailbox
+}
+
+// Snapshot returns the current state.
+func (m *MailboxState) Snapshot() MailboxStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot()
+}
+
+func (m *MailboxState) snapshot() MailboxStatus {
+	s := m.status
+	s.Flags = copyFlags(s.Flags)
+	s.PermanentFlags = copyFlags(s.PermanentFlags)
+	return s
+}
+
+func copyFlags(f Flags) Flags {
+	if f == nil {
+		return nil
+	}
+	c := make(Flags, len(f))
+	for flag := range f {
+		c[flag] = struct{}{}
+	}
+	return c
+}
+
+// UID returns the UID of message seq, or 0 if it isn't known.
+func (m *MailboxState) UID(seq int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if seq < 1 || seq > len(m.uids) {
+		return 0
+	}
+	return m.uids[seq-1]
+}
+
+// SeqNum returns the sequence number of the message with the given
+// UID, or 0 if it isn't known.
+func (m *MailboxState) SeqNum(uid int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, u := range m.uids {
+		if u == uid {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// UIDs returns the known UIDs by sequence number: element i is the
+// UID of message i+1, or 0 if unknown.
+func (m *MailboxState) UIDs() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int(nil), m.uids...)
+}
+
+// Subscribe returns a channel on which the state is sent whenever it
+// changes, and a function to stop the subscription.  Only the latest
+// state is kept for a slow reader; intermediate states are skipped.
+func (m *MailboxState) Subscribe() (<-chan MailboxStatus, func()) {
+	ch := make(chan MailboxStatus, 1)
+	m.mu.Lock()
+	m.subs = append(m.subs, ch)
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, sub := range m.subs {
+			if sub == ch {
+				m.subs = append(m.subs[:i:i], m.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify sends the state to subscribers.  Called with mu held.
+func (m *MailboxState) notify() {
+	if len(m.subs) == 0 {
+		return
+	}
+	s := m.snapshot()
+	for _, ch := range m.subs {
+		// Replace any state the subscriber hasn't read yet.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s
+	}
+}
+
+// reset starts tracking a newly selected mailbox.
+func (m *MailboxState) reset(name string, readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = MailboxStatus{Name: name, ReadOnly: readOnly}
+	m.uids = nil
+	m.notify()
+}
+
+// setReadOnly records the READ-ONLY or READ-WRITE code of a SELECT.
+func (m *MailboxState) setReadOnly(readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status.ReadOnly = readOnly
+	m.notify()
+}
+
+// apply updates the state from untagged server data, or from the
+// response code of a tagged OK.  UIDNext is only ever what the server
+// said, in UIDNEXT or STATUS: a FETCH's UID says nothing of it.
+func (m *MailboxState) apply(r interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status.Name == "" {
+		return
+	}
+
+	switch r := r.(type) {
+	case *ResponseExists:
+		m.status.Exists = r.Count
+		if r.Count < len(m.uids) {
+			// Shouldn't happen, but the server knows best.
+			m.uids = m.uids[:r.Count]
+		}
+		for len(m.uids) < r.Count {
+			m.uids = append(m.uids, 0)
+		}
+	case *ResponseRecent:
+		m.status.Recent = r.Count
+	case *ResponseExpunge:
+		if r.SeqNum >= 1 && r.SeqNum <= len(m.uids) {
+			m.uids = append(m.uids[:r.SeqNum-1], m.uids[r.SeqNum:]...)
+		}
+		if m.status.Exists > 0 {
+			m.status.Exists--
+		}
+	case *ResponseVanished:
+		if r.Earlier {
+			// Gone before, and already left out of EXISTS.
+			return
+		}
+		m.vanish(r)
+	case *ResponseFetch:
+		if r.UID == 0 || r.Msg < 1 {
+			return
+		}
+		for len(m.uids) < r.Msg {
+			m.uids = append(m.uids, 0)
+		}
+		m.uids[r.Msg-1] = r.UID
+	case *ResponseFlags:
+		m.status.Flags = r.Flags
+	case *ResponsePermanentFlags:
+		m.status.PermanentFlags = r.Flags
+	case *ResponseUIDValidity:
+		if m.status.UIDValidity != 0 && m.status.UIDValidity != r.Value {
+			// Every UID we know is now meaningless.
+			for i := range m.uids {
+				m.uids[i] = 0
+			}
+		}
+		m.status.UIDValidity = r.Value
+	case *ResponseUIDNext:
+		m.status.UIDNext = r.Value
+	case *ResponseHighestModSeq:
+		m.status.HighestModSeq = r.Value
+	case *ResponseMailboxStatus:
+		if !sameMailbox(r.Mailbox, m.status.Name) {
+			return
+		}
+		if n, ok := r.Items["UIDNEXT"]; ok {
+			m.status.UIDNext = int(n)
+		}
+		if n, ok := r.Items["HIGHESTMODSEQ"]; ok {
+			m.status.HighestModSeq = n
+		}
+	default:
+		return
+	}
+	m.notify()
+}
+
+// vanish removes the messages a VANISHED response reports expunged.
+// Membership is tested against the set's ranges, which a server may
+// make as wide as it likes.  Called with mu held.
+func (m *MailboxState) vanish(r *ResponseVanished) {
+	set, ok := parseSeqSet(r.Set)
+	if !ok {
+		return
+	}
+	kept := m.uids[:0]
+	unknown := -1
+	removed := 0
+	for _, uid := range m.uids {
+		if uid == 0 && unknown < 0 {
+			unknown = len(kept)
+		}
+		if uid != 0 && set.contains(uid) {
+			removed++
+			continue
+		}
+		kept = append(kept, uid)
+	}
+	m.uids = kept
+
+	n := set.size()
+	if n < 0 || n > m.status.Exists {
+		n = m.status.Exists
+	}
+	m.status.Exists -= n
+	if n > removed && unknown >= 0 {
+		// Messages we had no UID for went, so we can't tell the
+		// sequence numbers of the ones after the first of those.
+		for i := unknown; i < len(m.uids); i++ {
+			m.uids[i] = 0
+		}
+	}
+	if len(m.uids) > m.status.Exists {
+		m.uids = m.uids[:m.status.Exists]
+	}
+}
+
+// knownUIDs returns the UIDs known, as a set such as "1:5,9", or ""
+// if none.
+func (m *MailboxState) knownUIDs() string {
+	return formatUIDSet(m.UIDs())
+}
+
+// formatUIDSet returns UIDs as a set such as "1:5,9", leaving out
+// zeroes, or "" if there are none.
+func formatUIDSet(uids []int) string {
+	uids = append([]int(nil), uids...)
+	sort.Ints(uids)
+	var parts []string
+	for i := 0; i < len(uids); {
+		if uids[i] == 0 {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(uids) && uids[j+1] <= uids[j]+1 {
+			j++
+		}
+		if uids[i] == uids[j] {
+			parts = append(parts, strconv.Itoa(uids[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%d", uids[i], uids[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// sameMailbox reports whether two mailbox names are the same, INBOX
+// being case-insensitive.
+func sameMailbox(a, b string) bool {
+	return a == b || strings.EqualFold(a, "INBOX") && strings.EqualFold(b, "INBOX")
+}
+
+// mailboxArg returns the unquoted mailbox name argument of a SELECT or
+// EXAMINE command line.
+func mailboxArg(text string) string {
+	i := strings.IndexByte(text, ' ')
+	if i < 0 {
+		return ""
+	}
+	arg := text[i+1:]
+	if !strings.HasPrefix(arg, "\"") {
+		if j := strings.IndexByte(arg, ' '); j >= 0 {
+			arg = arg[:j]
+		}
+		return arg
+	}
+	var name []byte
+	for j := 1; j < len(arg); j++ {
+		switch arg[j] {
+		case '\\':
+			if j+1 < len(arg) {
+				j++
+				name = append(name, arg[j])
+			}
+		case '"':
+			return string(name)
+		default:
+			name = append(name, arg[j])
+		}
+	}
+	return string(name)
+}
@@ -0,0 +1,125 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMailboxState(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	updates, stop := imap.Mailbox().Subscribe()
+	defer stop()
+
+	done := async(func() error {
+		_, err := imap.Select("Sent Items")
+		return err
+	})
+	srv.expect(`a0 SELECT "Sent Items"`)
+	srv.send(
+		`* FLAGS (\Answered \Flagged \Deleted \Seen \Draft)`,
+		`* OK [PERMANENTFLAGS (\Deleted \Seen \*)] Limited`,
+		`* 4 EXISTS`,
+		`* 1 RECENT`,
+		`* OK [UIDVALIDITY 3857529045] UIDs valid`,
+		`* OK [UIDNEXT 4392] Predicted next UID`,
+		`* OK [HIGHESTMODSEQ 715194045007] Highest`,
+		`a0 OK [READ-WRITE] SELECT completed`,
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+
+	want := MailboxStatus{
+		Name:           "Sent Items",
+		Exists:         4,
+		Recent:         1,
+		UIDValidity:    3857529045,
+		UIDNext:        4392,
+		Flags:          NewFlags(FlagAnswered, FlagFlagged, FlagDeleted, FlagSeen, FlagDraft),
+		PermanentFlags: NewFlags(FlagDeleted, FlagSeen, FlagWildcard),
+		HighestModSeq:  715194045007,
+	}
+	if got := imap.Mailbox().Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Snapshot() = %+v, want %+v", got, want)
+	}
+
+	// Learn the UIDs, then lose message 2 and gain message 4.
+	srv.send(
+		`* 1 FETCH (UID 4388 FLAGS ())`,
+		`* 2 FETCH (UID 4389 FLAGS ())`,
+		`* 3 FETCH (UID 4390 FLAGS ())`,
+		`* 4 FETCH (UID 4391 FLAGS ())`,
+		`* 2 EXPUNGE`,
+		`* 4 EXISTS`,
+	)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-updates:
+			if s.Exists != 4 || imap.Mailbox().UID(2) != 4390 {
+				continue
+			}
+		case <-deadline:
+			t.Fatalf("no update; UIDs are %v", imap.Mailbox().UIDs())
+		}
+		break
+	}
+	if got, want := imap.Mailbox().UIDs(), []int{4388, 4390, 4391, 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UIDs() = %v, want %v", got, want)
+	}
+	if seq := imap.Mailbox().SeqNum(4391); seq != 3 {
+		t.Fatalf("SeqNum(4391) = %d, want 3", seq)
+	}
+}
+
+func TestMailboxArg(t *testing.T) {
+	tests := map[string]string{
+		`SELECT INBOX`:             "INBOX",
+		`EXAMINE "Sent Items"`:     "Sent Items",
+		`SELECT "a \"b\" c" (X)`:   `a "b" c`,
+		`SELECT INBOX (CONDSTORE)`: "INBOX",
+		`SELECT "back\\slash"`:     `back\slash`,
+	}
+	for text, want := range tests {
+		if got := mailboxArg(text); got != want {
+			t.Errorf("mailboxArg(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestMailboxUIDNextAndModSeq(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	done := async(func() error {
+		_, err := imap.Select("INBOX")
+		return err
+	})
+	srv.expect(`a0 SELECT "INBOX"`)
+	srv.send("* 2 EXISTS", "* OK [UIDNEXT 50] next", "* OK [HIGHESTMODSEQ 7] ok", "a0 OK [READ-WRITE] done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+
+	// A FETCH's UID isn't taken as a hint of UIDNEXT, a STATUS of the
+	// selected mailbox is, and so is a tagged OK's HIGHESTMODSEQ.
+	done = async(imap.Noop)
+	srv.expect("a1 NOOP")
+	srv.send("* 2 FETCH (UID 90)", "* STATUS inbox (UIDNEXT 60 HIGHESTMODSEQ 8)", "a1 OK [HIGHESTMODSEQ 9] done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Noop: %s", err)
+	}
+	if s := imap.Mailbox().Snapshot(); s.UIDNext != 60 || s.HighestModSeq != 9 {
+		t.Errorf("UIDNext %d, HighestModSeq %d; want 60, 9", s.UIDNext, s.HighestModSeq)
+	}
+
+	done = async(imap.Noop)
+	srv.expect("a2 NOOP")
+	srv.send("* STATUS Other (UIDNEXT 70)", "a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Noop: %s", err)
+	}
+	if s := imap.Mailbox().Snapshot(); s.UIDNext != 60 {
+		t.Errorf("UIDNext %d after another mailbox's STATUS, want 60", s.UIDNext)
+	}
+}
@@ -0,0 +1,289 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetadataDepthInfinity is the MetadataOptions.Depth that returns all
+// the entries below those named.
+const MetadataDepthInfinity = -1
+
+// MetadataOptions limits what GetMetadata returns.
+type MetadataOptions struct {
+	// MaxSize leaves out values of more than this many bytes, which
+	// the result's LongEntries then reports; 0 means no limit.
+	MaxSize int
+
+	// Depth also returns the entries below those named: 1 for their
+	// children, MetadataDepthInfinity for all their descendants.
+	Depth int
+}
+
+// ResponseMetadata is a METADATA response (RFC 5464): the values of a
+// mailbox's entries, or of the server's if Mailbox is "".  Entries
+// without a value are left out.
+//
+// The server may also send one unasked to say which entries changed;
+// it then has their names in Changed, and no Entries.
+type ResponseMetadata struct {
+	Mailbox string
+	Entries map[string][]byte
+	Changed []string
+
+	// LongEntries is, in GetMetadata's result, the size of the
+	// largest value left out for being over MaxSize, or 0.
+	LongEntries int
+}
+
+// These are matched, with errors.Is, by the *IMAPError of a
+// SETMETADATA that failed with the [METADATA ...] code of the same
+// name.
+var (
+	// ErrMetadataMaxSize: a value is over the server's limit, which
+	// MetadataMaxSize returns.
+	ErrMetadataMaxSize = errors.New("imap: metadata value too large")
+	// ErrMetadataTooMany: the mailbox has too many entries.
+	ErrMetadataTooMany = errors.New("imap: too many metadata entries")
+	// ErrMetadataNoPrivate: /private entries aren't supported.
+	ErrMetadataNoPrivate = errors.New("imap: no private metadata")
+)
+
+// MetadataMaxSize returns the server's limit on the size of values,
+// if err is ErrMetadataMaxSize and the server said.
+func MetadataMaxSize(err error) (int, bool) {
+	var imapErr *IMAPError
+	if !errors.As(err, &imapErr) {
+		return 0, false
+	}
+	cond, n, ok := parseMetadataCode(imapErr.Code)
+	return n, ok && cond == "MAXSIZE" && n > 0
+}
+
+// parseMetadataCode splits a "METADATA ..." response code into its
+// condition and number, if any.
+func parseMetadataCode(code interface{}) (cond string, n int, ok bool) {
+	s, ok := code.(string)
+	if !ok {
+		return "", 0, false
+	}
+	fields := strings.Fields(s)
+	if len(fields) < 2 || fields[0] != "METADATA" {
+		return "", 0, false
+	}
+	if len(fields) > 2 {
+		n, _ = strconv.Atoi(fields[2])
+	}
+	return strings.ToUpper(fields[1]), n, true
+}
+
+func (r *reader) readMETADATA() *ResponseMetadata {
+	// mailbox SP ("(" entry SP value *(SP entry SP value) ")" /
+	//             entry *(SP entry))
+	mailbox, err := r.readAString()
+	check(err)
+	check(r.expect(" "))
+	md := &ResponseMetadata{Mailbox: mailbox}
+
+	c, err := r.ReadByte()
+	check(err)
+	check(r.UnreadByte())
+	if c != '(' {
+		md.Changed = r.readAStrings()
+		return md
+	}
+
+	list, err := r.readSexp()
+	check(err)
+	if len(list)%2 != 0 {
+		panic(fmt.Errorf("bad METADATA entries %#v", list))
+	}
+	md.Entries = make(map[string][]byte, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		name, ok := list[i].(string)
+		if !ok {
+			panic(fmt.Errorf("bad METADATA entry %#v", list[i]))
+		}
+		switch value := list[i+1].(type) {
+		case string:
+			md.Entries[name] = []byte(value)
+		case []byte:
+			md.Entries[name] = value
+		case nil:
+		default:
+			panic(fmt.Errorf("bad METADATA value %#v", value))
+		}
+	}
+	check(r.expectEOL())
+	return md
+}
+
+// GetMetadata returns the values of the named entries of a mailbox,
+// or of the server if mailbox is "", as in "/private/comment".  opts
+// may be nil.
+func (imap *IMAP) GetMetadata(mailbox string, entries []string, opts *MetadataOptions) (*ResponseMetadata, error) {
+	return imap.GetMetadataContext(context.Background(), mailbox, entries, opts)
+}
+
+func (imap *IMAP) GetMetadataContext(ctx context.Context, mailbox string, entries []string, opts *MetadataOptions) (*ResponseMetadata, error) {
+	c, err := imap.GetMetadataAsyncContext(ctx, mailbox, entries, opts)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &ResponseMetadata{Mailbox: mailbox, Entries: make(map[string][]byte)}
+	for _, extra := range resp.Extra {
+		if r, ok := extra.(*ResponseMetadata); ok && r.Mailbox == mailbox && r.Entries != nil {
+			for name, value := range r.Entries {
+				md.Entries[name] = value
+			}
+		} else {
+			imap.unsolicited(extra)
+		}
+	}
+	if cond, n, ok := parseMetadataCode(resp.Code); ok && cond == "LONGENTRIES" {
+		md.LongEntries = n
+	}
+	return md, nil
+}
+
+func (imap *IMAP) GetMetadataAsync(mailbox string, entries []string, opts *MetadataOptions) (*Command, error) {
+	return imap.GetMetadataAsyncContext(context.Background(), mailbox, entries, opts)
+}
+
+func (imap *IMAP) GetMetadataAsyncContext(ctx context.Context, mailbox string, entries []string, opts *MetadataOptions) (*Command, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("imap: GETMETADATA of no entries")
+	}
+	return imap.SendAsyncContext(ctx, "%s", formatGetMetadata(mailbox, entries, opts))
+}
+
+func formatGetMetadata(mailbox string, entries []string, opts *MetadataOptions) string {
+	var b strings.Builder
+	b.WriteString("GETMETADATA")
+	if opts != nil {
+		var options []string
+		if opts.MaxSize > 0 {
+			options = append(options, fmt.Sprintf("MAXSIZE %d", opts.MaxSize))
+		}
+		switch {
+		case opts.Depth == MetadataDepthInfinity:
+			options = append(options, "DEPTH infinity")
+		case opts.Depth > 0:
+			options = append(options, fmt.Sprintf("DEPTH %d", opts.Depth))
+		}
+		if len(options) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(options, " "))
+		}
+	}
+	quoted := make([]string, len(entries))
+	for i, entry := range entries {
+		quoted[i] = quote(entry)
+	}
+	fmt.Fprintf(&b, " %s (%s)", quote(mailbox), strings.Join(quoted, " "))
+	return b.String()
+}
+
+// SetMetadata sets entries of a mailbox, or of the server if mailbox
+// is "".  An entry with a nil value is removed.  A failure owing to
+// the METADATA limits matches ErrMetadataMaxSize, ErrMetadataTooMany
+// or ErrMetadataNoPrivate.
+func (imap *IMAP) SetMetadata(mailbox string, entries map[string][]byte) error {
+	return imap.SetMetadataContext(context.Background(), mailbox, entries)
+}
+
+func (imap *IMAP) SetMetadataContext(ctx context.Context, mailbox string, entries map[string][]byte) error {
+	c, err := imap.SetMetadataAsyncContext(ctx, mailbox, entries)
+	if err != nil {
+		return err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+	for _, extra := range resp.Extra {
+		imap.unsolicited(extra)
+	}
+	return nil
+}
+
+func (imap *IMAP) SetMetadataAsync(mailbox string, entries map[string][]byte) (*Command, error) {
+	return imap.SetMetadataAsyncContext(context.Background(), mailbox, entries)
+}
+
+// SetMetadataAsyncContext is SetMetadataAsync with a context.  Values
+// that can't be sent as quoted strings go as literals: inline if the
+// server has LITERAL+ or LITERAL-, or else each after the server's go
+// ahead, so that it may return before the command is all sent only
+// if the server refuses it.
+func (imap *IMAP) SetMetadataAsyncContext(ctx context.Context, mailbox string, entries map[string][]byte) (*Command, error) {
+	nonSync := func(n int) bool {
+		return imap.Has("LITERAL+") || imap.Has("LITERAL-") && n <= 4096
+	}
+	parts := formatSetMetadata(mailbox, entries, nonSync)
+	cmd := newCommand(parts[0], nil)
+	cmd.keep = true
+	if err := imap.issueLiterals(ctx, cmd, parts); err != nil {
+		return nil, err
+	}
+	return &Command{imap: imap, cmd: cmd}, nil
+}
+
+// formatSetMetadata returns the text of a SETMETADATA, split after
+// each synchronizing literal; nonSync says whether one of n bytes may
+// be sent without waiting instead.
+func formatSetMetadata(mailbox string, entries map[string][]byte, nonSync func(n int) bool) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	var b strings.Builder
+	fmt.Fprintf(&b, "SETMETADATA %s (", quote(mailbox))
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		value := entries[name]
+		fmt.Fprintf(&b, "%s ", quote(name))
+		switch {
+		case value == nil:
+			b.WriteString("NIL")
+		case quotable(value):
+			b.WriteString(quote(string(value)))
+		case nonSync(len(value)):
+			fmt.Fprintf(&b, "{%d+}\r\n", len(value))
+			b.Write(value)
+		default:
+			fmt.Fprintf(&b, "{%d}", len(value))
+			parts = append(parts, b.String())
+			b.Reset()
+			b.Write(value)
+		}
+	}
+	b.WriteByte(')')
+	return append(parts, b.String())
+}
+
+// quotable reports whether a value can be sent as a quoted string.
+func quotable(value []byte) bool {
+	if len(value) > 1024 {
+		return false
+	}
+	for _, c := range value {
+		if c < ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
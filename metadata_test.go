@@ -0,0 +1,171 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGetMetadata(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	var md *ResponseMetadata
+	done := async(func() (err error) {
+		md, err = imap.GetMetadata("INBOX", []string{"/private/comment", "/shared/vendor"}, &MetadataOptions{MaxSize: 1024, Depth: MetadataDepthInfinity})
+		return err
+	})
+	srv.expect(`a0 GETMETADATA (MAXSIZE 1024 DEPTH infinity) "INBOX" ("/private/comment" "/shared/vendor")`)
+	srv.send(
+		`* METADATA "INBOX" (/private/comment "My \"own\" comment" /shared/vendor/a NIL)`,
+		`* METADATA "INBOX" (/shared/vendor/b {5}`, "two\r\n)",
+		`* METADATA "Sent" /shared/comment`,
+		"a0 OK [METADATA LONGENTRIES 2199] done",
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetMetadata: %s", err)
+	}
+	want := &ResponseMetadata{
+		Mailbox: "INBOX",
+		Entries: map[string][]byte{
+			"/private/comment": []byte(`My "own" comment`),
+			"/shared/vendor/b": []byte("two\r\n"),
+		},
+		LongEntries: 2199,
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("got %#v, want %#v", md, want)
+	}
+
+	done = async(func() (err error) {
+		md, err = imap.GetMetadata("", []string{"/shared/admin"}, nil)
+		return err
+	})
+	srv.expect(`a1 GETMETADATA "" ("/shared/admin")`)
+	srv.send(`* METADATA "" (/shared/admin "mailto:postmaster@example.com")`, "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetMetadata: %s", err)
+	}
+	if got := string(md.Entries["/shared/admin"]); got != "mailto:postmaster@example.com" || md.LongEntries != 0 {
+		t.Errorf("got %#v", md)
+	}
+
+	// Names are escaped as need be.
+	done = async(func() (err error) {
+		_, err = imap.GetMetadata(`Odd "box" \ 1`, []string{`/private/a"b`}, nil)
+		return err
+	})
+	srv.expect(`a2 GETMETADATA "Odd \"box\" \\ 1" ("/private/a\"b")`)
+	srv.send("a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetMetadata: %s", err)
+	}
+
+	if _, err := imap.GetMetadata("INBOX", nil, nil); err == nil {
+		t.Errorf("GetMetadata of no entries: no error")
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	done := async(func() error {
+		return imap.SetMetadata("INBOX", map[string][]byte{
+			"/private/comment": []byte(`a "b" \c`),
+			"/private/color":   nil,
+		})
+	})
+	srv.expect(`a0 SETMETADATA "INBOX" ("/private/color" NIL "/private/comment" "a \"b\" \\c")`)
+	srv.send("a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("SetMetadata: %s", err)
+	}
+
+	// Without LITERAL+, each literal waits for the server's go-ahead.
+	done = async(func() error {
+		return imap.SetMetadata("", map[string][]byte{"/shared/motd": []byte("one\r\ntwo")})
+	})
+	srv.expect(`a1 SETMETADATA "" ("/shared/motd" {8}`)
+	srv.send("+ go ahead")
+	srv.expect("one")
+	srv.expect("two)")
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("SetMetadata: %s", err)
+	}
+
+	// A refused literal isn't sent.
+	done = async(func() error {
+		return imap.SetMetadata("INBOX", map[string][]byte{"/private/x": []byte("\x01")})
+	})
+	srv.expect(`a2 SETMETADATA "INBOX" ("/private/x" {1}`)
+	srv.send("a2 NO [METADATA MAXSIZE 0] too big")
+	err := wait(t, done)
+	if !errors.Is(err, ErrMetadataMaxSize) || errors.Is(err, ErrMetadataTooMany) {
+		t.Fatalf("SetMetadata: got %v, want MAXSIZE", err)
+	}
+	if n, ok := MetadataMaxSize(err); ok {
+		t.Errorf("MetadataMaxSize = %d, want none", n)
+	}
+
+	done = async(func() error {
+		return imap.SetMetadata("INBOX", map[string][]byte{"/private/x": []byte("y")})
+	})
+	srv.expect(`a3 SETMETADATA "INBOX" ("/private/x" "y")`)
+	srv.send("a3 NO [METADATA NOPRIVATE] no private entries")
+	err = wait(t, done)
+	if imapErr, ok := err.(*IMAPError); !ok || imapErr.Status != NO || !errors.Is(err, ErrMetadataNoPrivate) {
+		t.Errorf("SetMetadata: got %#v, want an IMAPError for NOPRIVATE", err)
+	}
+
+	done = async(func() error {
+		return imap.SetMetadata("INBOX", map[string][]byte{"/private/x": []byte("yy")})
+	})
+	srv.expect(`a4 SETMETADATA "INBOX" ("/private/x" "yy")`)
+	srv.send("a4 NO [METADATA MAXSIZE 1] too big")
+	if n, ok := MetadataMaxSize(wait(t, done)); !ok || n != 1 {
+		t.Errorf("MetadataMaxSize = %d, %v; want 1", n, ok)
+	}
+}
+
+func TestSetMetadataLiteralPlus(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 LITERAL+ METADATA] ready")
+
+	done := async(func() error {
+		return imap.SetMetadata("INBOX", map[string][]byte{"/private/a": []byte("1\n2"), "/private/b": []byte("x")})
+	})
+	srv.expect(`a0 SETMETADATA "INBOX" ("/private/a" {3+}`)
+	srv.expect("1")
+	srv.expect(`2 "/private/b" "x")`)
+	srv.send("a0 NO [METADATA TOOMANY] too many")
+	var imapErr *IMAPError
+	if err := wait(t, done); !errors.Is(err, ErrMetadataTooMany) || !errors.As(err, &imapErr) {
+		t.Errorf("SetMetadata: got %v, want TOOMANY", err)
+	}
+}
+
+func TestSetMetadataCancel(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := async(func() error {
+		return imap.SetMetadataContext(ctx, "", map[string][]byte{"/shared/motd": []byte("a\r\nb")})
+	})
+	srv.expect(`a0 SETMETADATA "" ("/shared/motd" {4}`)
+	cancel()
+	if err := wait(t, done); err != context.Canceled {
+		t.Fatalf("SetMetadataContext: got %v, want context.Canceled", err)
+	}
+
+	// The server still gets the rest of the command when it asks.
+	done = async(imap.Noop)
+	srv.send("+ go ahead")
+	srv.expect("a")
+	srv.expect("b)")
+	srv.send("a0 OK done")
+	srv.expect("a1 NOOP")
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Errorf("Noop: %s", err)
+	}
+}
@@ -0,0 +1,148 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Namespace is a part of the server's mailbox hierarchy (RFC 2342):
+// its mailboxes' names start with Prefix, as in "#shared/" or "Other
+// Users.", and use Delim between levels.  Extensions holds the
+// namespace response extensions, such as TRANSLATION, by name.
+type Namespace struct {
+	Prefix     string
+	Delim      string
+	Extensions map[string][]string
+}
+
+// ResponseNamespace is a NAMESPACE response: the user's own
+// mailboxes, other users' and the shared ones.  Servers usually have
+// a single personal namespace, and may have no others.
+type ResponseNamespace struct {
+	Personal, Other, Shared []Namespace
+}
+
+// All returns the namespaces of all three kinds.
+func (r *ResponseNamespace) All() []Namespace {
+	all := append([]Namespace{}, r.Personal...)
+	all = append(all, r.Other...)
+	return append(all, r.Shared...)
+}
+
+func (r *reader) readNAMESPACE() *ResponseNamespace {
+	// Namespace SP Namespace SP Namespace, each NIL or a list
+	ns := &ResponseNamespace{}
+	for i, kind := range []*[]Namespace{&ns.Personal, &ns.Other, &ns.Shared} {
+		if i > 0 {
+			check(r.expect(" "))
+		}
+		c, err := r.ReadByte()
+		check(err)
+		check(r.UnreadByte())
+		if c != '(' {
+			check(r.expect("NIL"))
+			continue
+		}
+		list, err := r.readSexp()
+		check(err)
+		for _, desc := range list {
+			*kind = append(*kind, namespaceFromSexp(desc))
+		}
+	}
+	check(r.expectEOL())
+	return ns
+}
+
+// namespaceFromSexp converts a Namespace-Descr:
+// "(" string SP (DQUOTE QUOTED-CHAR DQUOTE / nil) *(Namespace-Response-Extension) ")"
+func namespaceFromSexp(s sexp) Namespace {
+	desc, ok := s.([]sexp)
+	if !ok || len(desc) < 2 {
+		panic(fmt.Errorf("bad namespace %#v", s))
+	}
+	var ns Namespace
+	switch prefix := desc[0].(type) {
+	case string:
+		ns.Prefix = prefix
+	case []byte:
+		ns.Prefix = string(prefix)
+	default:
+		panic(fmt.Errorf("bad namespace prefix %#v", desc[0]))
+	}
+	if delim := nilOrString(desc[1]); delim != nil {
+		ns.Delim = *delim
+	}
+	for i := 2; i+1 < len(desc); i += 2 {
+		name, _ := desc[i].(string)
+		values, _ := desc[i+1].([]sexp)
+		if ns.Extensions == nil {
+			ns.Extensions = make(map[string][]string)
+		}
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if str, ok := v.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+		ns.Extensions[strings.ToUpper(name)] = strs
+	}
+	return ns
+}
+
+// Namespace asks for the server's namespaces, to know the reference
+// to List other users' or shared mailboxes under.  If the server is
+// known not to have NAMESPACE, the one personal namespace is worked
+// out with LIST instead.
+func (imap *IMAP) Namespace() (*ResponseNamespace, error) {
+	return imap.NamespaceContext(context.Background())
+}
+
+func (imap *IMAP) NamespaceContext(ctx context.Context) (*ResponseNamespace, error) {
+	if imap.Capabilities() != nil && !imap.Has("NAMESPACE") {
+		return imap.personalNamespace(ctx)
+	}
+	c, err := imap.NamespaceAsyncContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ns *ResponseNamespace
+	for _, extra := range resp.Extra {
+		if r, ok := extra.(*ResponseNamespace); ok && ns == nil {
+			ns = r
+		} else {
+			imap.unsolicited(extra)
+		}
+	}
+	if ns == nil {
+		return nil, fmt.Errorf("imap: no NAMESPACE response")
+	}
+	return ns, nil
+}
+
+func (imap *IMAP) NamespaceAsync() (*Command, error) {
+	return imap.NamespaceAsyncContext(context.Background())
+}
+
+func (imap *IMAP) NamespaceAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "NAMESPACE")
+}
+
+// personalNamespace stands in for NAMESPACE: LIST "" "" returns the
+// hierarchy delimiter of the root.
+func (imap *IMAP) personalNamespace(ctx context.Context) (*ResponseNamespace, error) {
+	lists, err := imap.ListContext(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+	ns := Namespace{}
+	if len(lists) > 0 {
+		ns.Delim = lists[0].Delim
+	}
+	return &ResponseNamespace{Personal: []Namespace{ns}}, nil
+}
@@ -0,0 +1,54 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var ns *ResponseNamespace
+	done := async(func() (err error) {
+		ns, err = imap.Namespace()
+		return err
+	})
+	srv.expect("a0 NAMESPACE")
+	srv.send(
+		`* NAMESPACE (("" "/")("~" "/")) NIL (("#shared/" "/" "X-PARAM" ("FLAG1" "FLAG2"))("#public." NIL))`,
+		"a0 OK done",
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Namespace: %s", err)
+	}
+	want := &ResponseNamespace{
+		Personal: []Namespace{{Prefix: "", Delim: "/"}, {Prefix: "~", Delim: "/"}},
+		Shared: []Namespace{
+			{Prefix: "#shared/", Delim: "/", Extensions: map[string][]string{"X-PARAM": {"FLAG1", "FLAG2"}}},
+			{Prefix: "#public."},
+		},
+	}
+	if !reflect.DeepEqual(ns, want) {
+		t.Errorf("got %#v\nwant %#v", ns, want)
+	}
+	if n := len(ns.All()); n != 4 {
+		t.Errorf("All() has %d namespaces, want 4", n)
+	}
+}
+
+func TestNamespaceFallback(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1] ready")
+	var ns *ResponseNamespace
+	done := async(func() (err error) {
+		ns, err = imap.Namespace()
+		return err
+	})
+	srv.expect(`a0 LIST "" ""`)
+	srv.send(`* LIST (\Noselect) "." ""`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Namespace: %s", err)
+	}
+	want := &ResponseNamespace{Personal: []Namespace{{Delim: "."}}}
+	if !reflect.DeepEqual(ns, want) {
+		t.Errorf("got %#v, want %#v", ns, want)
+	}
+}
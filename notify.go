@@ -0,0 +1,125 @@
+package imap
+
+import (
+	"context"
+	"strings"
+)
+
+// NotifyFilter selects the mailboxes a NotifyGroup applies to.
+type NotifyFilter string
+
+const (
+	NotifySelected        NotifyFilter = "SELECTED"
+	NotifySelectedDelayed NotifyFilter = "SELECTED-DELAYED"
+	NotifyPersonal        NotifyFilter = "PERSONAL"
+	NotifyInboxes         NotifyFilter = "INBOXES"
+	NotifySubscribed      NotifyFilter = "SUBSCRIBED"
+	// NotifySubtree and NotifyMailboxes take the mailboxes from
+	// NotifyGroup.Mailboxes; the former includes their children.
+	NotifySubtree   NotifyFilter = "SUBTREE"
+	NotifyMailboxes NotifyFilter = "MAILBOXES"
+)
+
+// NotifyEvent is an event a NotifyGroup asks to hear about.
+type NotifyEvent string
+
+const (
+	// NotifyMessageNew and NotifyMessageExpunge must be asked for
+	// together.  Outside the selected mailbox they are reported as
+	// STATUS responses.
+	NotifyMessageNew     NotifyEvent = "MessageNew"
+	NotifyMessageExpunge NotifyEvent = "MessageExpunge"
+	NotifyFlagChange     NotifyEvent = "FlagChange"
+	// NotifyMailboxName reports created, deleted and renamed
+	// mailboxes as LIST responses; deleted ones are \NonExistent,
+	// renamed ones have OldName set.
+	NotifyMailboxName        NotifyEvent = "MailboxName"
+	NotifySubscriptionChange NotifyEvent = "SubscriptionChange"
+)
+
+// NotifyGroup is a set of mailboxes and the events wanted for them.
+// No events means none.
+type NotifyGroup struct {
+	Filter    NotifyFilter
+	Mailboxes []string
+	Events    []NotifyEvent
+}
+
+func (g NotifyGroup) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	b.WriteString(string(g.Filter))
+	if g.Filter == NotifySubtree || g.Filter == NotifyMailboxes {
+		names := make([]string, len(g.Mailboxes))
+		for i, name := range g.Mailboxes {
+			names[i] = quote(name)
+		}
+		b.WriteString(" (" + strings.Join(names, " ") + ")")
+	}
+	if len(g.Events) == 0 {
+		b.WriteString(" NONE")
+	} else {
+		events := make([]string, len(g.Events))
+		for i, e := range g.Events {
+			events[i] = string(e)
+		}
+		b.WriteString(" (" + strings.Join(events, " ") + ")")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// Notify asks the server (RFC 5465) to report the given events as
+// they happen, replacing any earlier request.  The reports arrive as
+// unsolicited data: EXISTS, EXPUNGE and FETCH for the selected
+// mailbox, and STATUS and LIST responses for the others, which go to
+// the handlers' OnMailboxStatus and OnList.
+func (imap *IMAP) Notify(groups ...NotifyGroup) error {
+	return imap.NotifyContext(context.Background(), groups...)
+}
+
+func (imap *IMAP) NotifyContext(ctx context.Context, groups ...NotifyGroup) error {
+	c, err := imap.NotifyAsyncContext(ctx, groups...)
+	if err != nil {
+		return err
+	}
+	_, err = c.wait(ctx)
+	return err
+}
+
+func (imap *IMAP) NotifyAsync(groups ...NotifyGroup) (*Command, error) {
+	return imap.NotifyAsyncContext(context.Background(), groups...)
+}
+
+func (imap *IMAP) NotifyAsyncContext(ctx context.Context, groups ...NotifyGroup) (*Command, error) {
+	if len(groups) == 0 {
+		return imap.NotifyNoneAsyncContext(ctx)
+	}
+	specs := make([]string, len(groups))
+	for i, g := range groups {
+		specs[i] = g.String()
+	}
+	return imap.SendAsyncContext(ctx, "NOTIFY SET %s", strings.Join(specs, " "))
+}
+
+// NotifyNone turns off notifications.
+func (imap *IMAP) NotifyNone() error {
+	return imap.NotifyNoneContext(context.Background())
+}
+
+func (imap *IMAP) NotifyNoneContext(ctx context.Context) error {
+	c, err := imap.NotifyNoneAsyncContext(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.wait(ctx)
+	return err
+}
+
+func (imap *IMAP) NotifyNoneAsync() (*Command, error) {
+	return imap.NotifyNoneAsyncContext(context.Background())
+}
+
+func (imap *IMAP) NotifyNoneAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "NOTIFY NONE")
+}
@@ -0,0 +1,112 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type notifyHandler struct {
+	NopHandler
+	events chan interface{}
+}
+
+func (h notifyHandler) OnList(r *ResponseList)                   { h.events <- r }
+func (h notifyHandler) OnMailboxStatus(r *ResponseMailboxStatus) { h.events <- r }
+
+func TestNotify(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := notifyHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	done := async(func() error {
+		return imap.Notify(
+			NotifyGroup{Filter: NotifySelected, Events: []NotifyEvent{NotifyMessageNew, NotifyMessageExpunge}},
+			NotifyGroup{Filter: NotifyMailboxes, Mailboxes: []string{"Shared/a", "b"}, Events: []NotifyEvent{NotifyMessageNew, NotifyMessageExpunge}},
+			NotifyGroup{Filter: NotifyPersonal, Events: []NotifyEvent{NotifyMailboxName}},
+			NotifyGroup{Filter: NotifySubtree, Mailboxes: []string{"Archive"}},
+		)
+	})
+	srv.expect(`a0 NOTIFY SET (SELECTED (MessageNew MessageExpunge)) (MAILBOXES ("Shared/a" "b") (MessageNew MessageExpunge)) (PERSONAL (MailboxName)) (SUBTREE ("Archive") NONE)`)
+	srv.send("a0 OK NOTIFY completed")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+
+	srv.send(
+		`* STATUS "Shared/a" (MESSAGES 12 UIDNEXT 40 UNSEEN 3)`,
+		`* LIST () "/" "Projects" ("OLDNAME" ("Old Projects"))`,
+	)
+	for _, want := range []interface{}{
+		&ResponseMailboxStatus{Mailbox: "Shared/a", Items: map[string]uint64{"MESSAGES": 12, "UIDNEXT": 40, "UNSEEN": 3}},
+		&ResponseList{Attributes: []string{}, Delim: "/", Name: "Projects", OldName: "Old Projects"},
+	} {
+		select {
+		case got := <-h.events:
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event")
+		}
+	}
+
+	done = async(imap.NotifyNone)
+	srv.expect("a1 NOTIFY NONE")
+	srv.send("a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("NotifyNone: %s", err)
+	}
+}
+
+func TestReadLIST(t *testing.T) {
+	no := false
+	tests := map[string]*ResponseList{
+		`* LIST (\NonExistent) "." INBOX.gone` + "\r\n": {
+			Attributes: []string{`\NonExistent`}, Selectable: &no, Delim: ".", Name: "INBOX.gone",
+		},
+		`* LIST (\Subscribed \Remote) NIL {5}` + "\r\nhello\r\n": {
+			Attributes: []string{`\Subscribed`, `\Remote`}, Name: "hello",
+		},
+	}
+	for input, want := range tests {
+		r := &reader{newParser(bytes.NewBufferString(input))}
+		_, got, err := r.readResponse()
+		if err != nil {
+			t.Errorf("%q: %s", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %#v, want %#v", input, got, want)
+		}
+	}
+}
+
+func TestStatusAmidNotify(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := notifyHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	var status *ResponseMailboxStatus
+	done := async(func() (err error) {
+		status, err = imap.Status("INBOX", "MESSAGES")
+		return err
+	})
+	srv.expect(`a0 STATUS "INBOX" (MESSAGES)`)
+	srv.send(`* STATUS "Shared/team" (MESSAGES 99)`, `* STATUS inbox (MESSAGES 4)`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Status: %s", err)
+	}
+	if status.Mailbox != "inbox" || status.Items["MESSAGES"] != 4 {
+		t.Errorf("got %#v, want INBOX's", status)
+	}
+	select {
+	case e := <-h.events:
+		if s, ok := e.(*ResponseMailboxStatus); !ok || s.Mailbox != "Shared/team" {
+			t.Errorf("handler got %#v, want Shared/team's STATUS", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Shared/team's STATUS didn't reach the handler")
+	}
+}
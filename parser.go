@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"errors"
 	"strconv"
 )
 
@@ -37,12 +36,119 @@ func nilOrString(s sexp) *string {
 	return &str
 }
 
+// DefaultMaxLineLength is the default limit on the length of a
+// response line (excluding literals).
+const DefaultMaxLineLength = 1 << 20
+
+// DefaultMaxLiteralLength is the default limit on the length of a
+// literal, such as a message fetched whole.
+const DefaultMaxLiteralLength = 1 << 30
+
+// LineTooLongError is returned when the server sends a line longer
+// than the limit.  The connection can't be used after this, as the
+// rest of the line is left unread.
+type LineTooLongError struct {
+	Limit int
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("imap: response line longer than %d bytes", e.Limit)
+}
+
+// LiteralTooLongError is returned when the server sends a literal
+// longer than the limit.  Like a LineTooLongError, it fails the
+// connection.
+type LiteralTooLongError struct {
+	Length, Limit int
+}
+
+func (e *LiteralTooLongError) Error() string {
+	return fmt.Sprintf("imap: literal of %d bytes is over the limit of %d", e.Length, e.Limit)
+}
+
+// parser reads responses.  It counts the bytes read of each response
+// line, but for its literals, against maxLine: its reading methods
+// fail with a *LineTooLongError once over it.
 type parser struct {
 	*bufio.Reader
+
+	// maxLine limits response lines, not counting literals, and
+	// maxLiteral literals; 0 means no limit.
+	maxLine, maxLiteral int
+
+	// lineLen is the length of the line so far; see startLine.
+	lineLen int
 }
 
 func newParser(r io.Reader) *parser {
-	return &parser{bufio.NewReader(r)}
+	return &parser{Reader: bufio.NewReader(r), maxLine: DefaultMaxLineLength, maxLiteral: DefaultMaxLiteralLength}
+}
+
+// startLine starts the count of a new response line.
+func (p *parser) startLine() {
+	p.lineLen = 0
+}
+
+// count charges n bytes read to the current line.
+func (p *parser) count(n int) error {
+	p.lineLen += n
+	if p.maxLine > 0 && p.lineLen > p.maxLine {
+		return &LineTooLongError{p.maxLine}
+	}
+	return nil
+}
+
+func (p *parser) Read(buf []byte) (int, error) {
+	n, err := p.Reader.Read(buf)
+	if cerr := p.count(n); cerr != nil {
+		return n, cerr
+	}
+	return n, err
+}
+
+func (p *parser) ReadByte() (byte, error) {
+	c, err := p.Reader.ReadByte()
+	if err != nil {
+		return c, err
+	}
+	return c, p.count(1)
+}
+
+func (p *parser) UnreadByte() error {
+	err := p.Reader.UnreadByte()
+	if err == nil {
+		p.lineLen--
+	}
+	return err
+}
+
+func (p *parser) ReadSlice(delim byte) ([]byte, error) {
+	line, err := p.Reader.ReadSlice(delim)
+	if cerr := p.count(len(line)); cerr != nil {
+		return line, cerr
+	}
+	return line, err
+}
+
+// ReadString is bufio.Reader's, but stops at the line limit rather
+// than reading on to the delimiter however far away it is.
+func (p *parser) ReadString(delim byte) (string, error) {
+	var buf []byte
+	for {
+		chunk, err := p.ReadSlice(delim)
+		buf = append(buf, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(buf), err
+		}
+	}
+}
+
+func (p *parser) ReadLine() ([]byte, bool, error) {
+	line, prefix, err := p.Reader.ReadLine()
+	if cerr := p.count(len(line)); cerr != nil {
+		return line, prefix, cerr
+	}
+	return line, prefix, err
 }
 
 func (p *parser) expect(text string) error {
@@ -102,6 +208,23 @@ func (p *parser) readNumber() (num int, outErr error) {
 	panic("not reached")
 }
 
+// readNumber64 reads a number that may not fit in an int, such as a
+// mod-sequence.
+func (p *parser) readNumber64() (num uint64, outErr error) {
+	defer recoverError(&outErr)
+
+	for {
+		c, err := p.ReadByte()
+		check(err)
+		if c >= '0' && c <= '9' {
+			num = num*10 + uint64(c-'0')
+		} else {
+			check(p.UnreadByte())
+			return num, nil
+		}
+	}
+}
+
 func (p *parser) readAtom() (outStr string, outErr error) {
 	/*
 		ATOM-CHAR       = <any CHAR except atom-specials>
@@ -116,9 +239,15 @@ func (p *parser) readAtom() (outStr string, outErr error) {
 		c, err := p.ReadByte()
 		check(err)
 
+		if c == '*' && atom.Len() == 1 && atom.Bytes()[0] == '\\' {
+			// The "\*" flag of PERMANENTFLAGS.
+			atom.WriteByte(c)
+			continue
+		}
+
 		switch c {
 		case '(', ')', '{', ' ',
-			// XXX: CTL
+			'\r', '\n', // XXX: the rest of CTL
 			'%', '*', // list-wildcards
 			'"': // quoted-specials
 			// XXX: note that I dropped '\' from the quoted-specials,
@@ -176,11 +305,16 @@ func (p *parser) readLiteral() (literal []byte, outErr error) {
 	length, err := strconv.Atoi(string(lengthBytes[0 : len(lengthBytes)-1]))
 	check(err)
 
+	if length < 0 || p.maxLiteral > 0 && length > p.maxLiteral {
+		return nil, &LiteralTooLongError{length, p.maxLiteral}
+	}
+
 	err = p.expect("\r\n")
 	check(err)
 
+	// Literals count against maxLiteral, not the line.
 	literal = make([]byte, length)
-	_, err = io.ReadFull(p, literal)
+	_, err = io.ReadFull(p.Reader, literal)
 	check(err)
 
 	return
@@ -207,28 +341,12 @@ func (p *parser) readSexp() (s []sexp, outErr error) {
 	for {
 		c, err := p.ReadByte()
 		check(err)
-
-		var exp sexp
-		switch c {
-		case ')':
+		if c == ')' {
 			return sexps, nil
-		case '(':
-			p.UnreadByte()
-			exp, err = p.readSexp()
-		case '"':
-			p.UnreadByte()
-			exp, err = p.readQuoted()
-		case '{':
-			p.UnreadByte()
-			exp, err = p.readLiteral()
-		default:
-			// TODO: may need to distinguish atom from string in practice.
-			p.UnreadByte()
-			exp, err = p.readAtom()
-			if exp == "NIL" {
-				exp = nil
-			}
 		}
+		check(p.UnreadByte())
+
+		exp, err := p.readSexpItem()
 		check(err)
 
 		sexps = append(sexps, exp)
@@ -244,6 +362,57 @@ func (p *parser) readSexp() (s []sexp, outErr error) {
 	panic("not reached")
 }
 
+// readSexpItem reads one element of an s-expression: a list, string,
+// literal or atom.
+func (p *parser) readSexpItem() (exp sexp, outErr error) {
+	defer recoverError(&outErr)
+
+	c, err := p.ReadByte()
+	check(err)
+
+	switch c {
+	case '(':
+		p.UnreadByte()
+		exp, err = p.readSexp()
+	case '"':
+		p.UnreadByte()
+		exp, err = p.readQuoted()
+	case '{':
+		p.UnreadByte()
+		exp, err = p.readLiteral()
+	case '~':
+		// A literal8, which IMAP4rev2 uses for BINARY data.
+		exp, err = p.readLiteral()
+	default:
+		// TODO: may need to distinguish atom from string in practice.
+		p.UnreadByte()
+		exp, err = p.readAtom()
+		if exp == "NIL" {
+			exp = nil
+		}
+	}
+	check(err)
+	return exp, nil
+}
+
+// readAString reads an astring: an atom, quoted string or literal, as
+// mailbox names are sent.
+func (p *parser) readAString() (str string, outErr error) {
+	defer recoverError(&outErr)
+
+	c, err := p.ReadByte()
+	check(err)
+	check(p.UnreadByte())
+	switch c {
+	case '"':
+		return p.readQuoted()
+	case '{':
+		literal, err := p.readLiteral()
+		return string(literal), err
+	}
+	return p.readAtom()
+}
+
 func (p *parser) readParenStringList() ([]string, error) {
 	sexp, err := p.readSexp()
 	if err != nil {
@@ -260,13 +429,22 @@ func (p *parser) readParenStringList() ([]string, error) {
 	return strs, nil
 }
 
+// readToEOL reads the rest of the line, of any length up to the line
+// limit, and consumes the CRLF.
 func (p *parser) readToEOL() (string, error) {
-	line, prefix, err := p.ReadLine()
-	if err != nil {
-		return "", err
-	}
-	if prefix {
-		return "", errors.New("got line prefix, buffer too small")
+	var buf []byte
+	for {
+		line, prefix, err := p.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if !prefix {
+			if buf == nil {
+				return string(line), nil
+			}
+			return string(append(buf, line...)), nil
+		}
+		// ReadLine's buffer is reused by the next call.
+		buf = append(buf, line...)
 	}
-	return string(line), nil
 }
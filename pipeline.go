@@ -0,0 +1,465 @@
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pipelining rules.
+//
+// RFC 3501 section 5.5 allows several commands to be in flight, but
+// leaves it to the client to avoid ambiguity: untagged data isn't
+// labelled with the command it answers, and EXPUNGE renumbers
+// messages under any command that uses sequence numbers.  The rules
+// here decide which pending command an untagged response belongs to
+// and which new commands have to wait for others to complete.
+
+// commandRule describes how a command behaves when pipelined.
+type commandRule struct {
+	// exclusive commands change the connection state (or, like
+	// IDLE, take over the connection) and must be the only command
+	// in flight.  All untagged data received meanwhile is theirs.
+	exclusive bool
+
+	// passive exclusive commands collect only continuations; the
+	// data received meanwhile is unsolicited.  That's IDLE, which
+	// exists to let the server send it.
+	passive bool
+
+	// all commands claim any untagged data no other pending command
+	// claims more specifically; e.g. NOOP, whose purpose is to
+	// collect whatever the server has to say.
+	all bool
+
+	// data lists the kinds of untagged data (see responseKind) the
+	// command collects.
+	data []string
+
+	// seqNums commands refer to messages by sequence number.
+	seqNums bool
+
+	// noExpunge commands are ones during which the server may not
+	// send EXPUNGE (RFC 3501 section 7.4.1).
+	noExpunge bool
+}
+
+var commandRules = map[string]commandRule{
+	"CAPABILITY": {data: []string{"CAPABILITY"}},
+	"NOOP":       {all: true},
+	"CHECK":      {all: true},
+
+	"LOGIN":        {exclusive: true},
+	"AUTHENTICATE": {exclusive: true},
+	"STARTTLS":     {exclusive: true},
+	"LOGOUT":       {exclusive: true},
+	"SELECT":       {exclusive: true},
+	"EXAMINE":      {exclusive: true},
+	"CLOSE":        {exclusive: true},
+	"UNSELECT":     {exclusive: true},
+	"IDLE":         {exclusive: true, passive: true},
+	"ENABLE":       {exclusive: true},
+
+	"LIST":        {data: []string{"LIST", "STATUS"}},
+	"LSUB":        {data: []string{"LSUB"}},
+	"STATUS":      {data: []string{"STATUS"}},
+	"NAMESPACE":   {data: []string{"NAMESPACE"}},
+	"CREATE":      {},
+	"DELETE":      {},
+	"RENAME":      {},
+	"SUBSCRIBE":   {},
+	"UNSUBSCRIBE": {},
+	"NOTIFY":      {},
+	"APPEND":      {},
+	"EXPUNGE":     {data: []string{"EXPUNGE", "VANISHED"}},
+
+	"GETQUOTA":     {data: []string{"QUOTA"}},
+	"GETQUOTAROOT": {data: []string{"QUOTAROOT", "QUOTA"}},
+	"SETQUOTA":     {data: []string{"QUOTA"}},
+	"GETACL":       {data: []string{"ACL"}},
+	"SETACL":       {},
+	"DELETEACL":    {},
+	"LISTRIGHTS":   {data: []string{"LISTRIGHTS"}},
+	"MYRIGHTS":     {data: []string{"MYRIGHTS"}},
+	"GETMETADATA":  {data: []string{"METADATA"}},
+	"SETMETADATA":  {},
+
+	"FETCH":  {data: []string{"FETCH"}, seqNums: true, noExpunge: true},
+	"STORE":  {data: []string{"FETCH"}, seqNums: true, noExpunge: true},
+	"SEARCH": {data: []string{"SEARCH", "ESEARCH"}, seqNums: true, noExpunge: true},
+	"COPY":   {seqNums: true},
+
+	"UID FETCH":  {data: []string{"FETCH"}},
+	"UID STORE":  {data: []string{"FETCH"}},
+	"UID SEARCH": {data: []string{"SEARCH", "ESEARCH"}},
+	"UID COPY":   {},
+}
+
+// Commands we know nothing about are serialised and get everything.
+var unknownCommandRule = commandRule{exclusive: true}
+
+// responseKind returns the kind of an untagged response for matching
+// against commandRule.data.
+func responseKind(r interface{}) string {
+	switch r.(type) {
+	case *ResponseCapabilities:
+		return "CAPABILITY"
+	case *ResponseList:
+		return "LIST"
+	case *ResponseMailboxStatus:
+		return "STATUS"
+	case *ResponseNamespace:
+		return "NAMESPACE"
+	case *ResponseQuota:
+		return "QUOTA"
+	case *ResponseQuotaRoot:
+		return "QUOTAROOT"
+	case *ResponseACL:
+		return "ACL"
+	case *ResponseListRights:
+		return "LISTRIGHTS"
+	case *ResponseMyRights:
+		return "MYRIGHTS"
+	case *ResponseMetadata:
+		return "METADATA"
+	case *ResponseSearch:
+		return "SEARCH"
+	case *ResponseESearch:
+		return "ESEARCH"
+	case *ResponseEnabled:
+		return "ENABLED"
+	case *ResponseFetch:
+		return "FETCH"
+	case *ResponseVanished:
+		return "VANISHED"
+	case *ResponseExpunge:
+		return "EXPUNGE"
+	case *ResponseContinuation:
+		return "+"
+	}
+	return ""
+}
+
+// command is a command in flight.
+type command struct {
+	tag  tag
+	name string
+	rule commandRule
+
+	// set is the messages a FETCH or STORE refers to, or nil if
+	// unknown.  uid says whether they're UIDs.
+	set seqSet
+	uid bool
+
+	// Responses are queued here by the reader and forwarded to ch
+	// by a goroutine of the command's own, so that a caller that is
+	// slow to read can't hold up responses to other commands.  ch
+	// is closed after the tagged status, or when the command fails.
+	// Once the caller abandons the command, quit is closed, ch too,
+	// and further responses are dropped.
+	ch        chan interface{}
+	mu        sync.Mutex
+	queue     []interface{}
+	wake      chan struct{}
+	quit      chan struct{}
+	done      bool
+	abandoned bool
+	status    *ResponseStatus
+
+	// keep commands, those of a Command, have no ch to start with:
+	// responses stay queued until taken, or streamed once the
+	// Command's caller sets ch.  Their status is never queued.
+	keep bool
+
+	// finished is closed when the command completes or fails.
+	finished chan struct{}
+
+	// cont, if set, is signalled by the server's continuation
+	// requests instead of their being delivered; see issueLiterals.
+	cont chan struct{}
+
+	// timer enforces CommandTimeout; guarded by mu.
+	timer *time.Timer
+}
+
+// newCommand prepares a command; its tag is assigned when it is sent.
+func newCommand(text string, ch chan interface{}) *command {
+	cmd := &command{
+		ch:       ch,
+		wake:     make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) > 0 {
+		cmd.name = strings.ToUpper(fields[0])
+		fields = fields[1:]
+	}
+	if cmd.name == "UID" && len(fields) > 0 {
+		cmd.name += " " + strings.ToUpper(fields[0])
+		fields = fields[1:]
+		cmd.uid = true
+	}
+
+	rule, ok := commandRules[cmd.name]
+	if !ok {
+		rule = unknownCommandRule
+	}
+	cmd.rule = rule
+
+	switch cmd.name {
+	case "FETCH", "STORE", "UID FETCH", "UID STORE":
+		if len(fields) > 0 {
+			cmd.set, _ = parseSeqSet(fields[0])
+		}
+	}
+
+	if ch != nil {
+		go cmd.forward()
+	}
+	return cmd
+}
+
+// wants reports whether the command collects untagged data of the
+// given kind specifically.
+func (cmd *command) wants(kind string) bool {
+	for _, k := range cmd.rule.data {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// owns reports whether a FETCH response is about one of the messages
+// the command refers to.
+func (cmd *command) owns(fetch *ResponseFetch) bool {
+	if cmd.set == nil {
+		return true
+	}
+	if cmd.uid {
+		return fetch.UID != 0 && cmd.set.contains(fetch.UID)
+	}
+	return cmd.set.contains(fetch.Msg)
+}
+
+// conflicts reports whether cmd has to wait for the pending command
+// other to complete before being sent.
+func (cmd *command) conflicts(other *command) bool {
+	if cmd.rule.exclusive || other.rule.exclusive {
+		return true
+	}
+	// Sequence numbers are ambiguous if an EXPUNGE may arrive
+	// before the server sees them.
+	if cmd.rule.seqNums && !other.rule.noExpunge {
+		return true
+	}
+	for _, kind := range cmd.rule.data {
+		if !other.wants(kind) {
+			continue
+		}
+		if kind != "FETCH" {
+			return true
+		}
+		// FETCH data can still be told apart by message, as long
+		// as both commands name their messages the same way and
+		// don't share any.
+		if cmd.set == nil || other.set == nil || cmd.uid != other.uid ||
+			cmd.set.overlaps(other.set) {
+			return true
+		}
+	}
+	return false
+}
+
+// wantsData reports whether the command takes the untagged data
+// routed to it.
+func (cmd *command) wantsData() bool {
+	return cmd.keep || cmd.ch != nil
+}
+
+// deliver queues a response for the command.
+func (cmd *command) deliver(r interface{}) {
+	cmd.mu.Lock()
+	if cmd.wantsData() && !cmd.done && !cmd.abandoned {
+		cmd.queue = append(cmd.queue, r)
+	}
+	cmd.mu.Unlock()
+	cmd.signal()
+}
+
+// abandon drops the command's responses from now on, returning false
+// if it had already completed.
+func (cmd *command) abandon() bool {
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+	if !cmd.abandoned {
+		cmd.abandoned = true
+		cmd.queue = nil
+		close(cmd.quit)
+	}
+	return !cmd.done
+}
+
+// finish marks the command complete with its tagged status, or
+// failed if status is nil.
+func (cmd *command) finish(status *ResponseStatus) {
+	cmd.mu.Lock()
+	if !cmd.done {
+		if status != nil && cmd.ch != nil && !cmd.keep && !cmd.abandoned {
+			cmd.queue = append(cmd.queue, status)
+		}
+		cmd.status = status
+		cmd.done = true
+		close(cmd.finished)
+		if cmd.timer != nil {
+			cmd.timer.Stop()
+		}
+	}
+	cmd.mu.Unlock()
+	cmd.signal()
+}
+
+// result returns the tagged status, or nil if the command failed.
+func (cmd *command) result() *ResponseStatus {
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+	return cmd.status
+}
+
+func (cmd *command) signal() {
+	select {
+	case cmd.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns the queued responses.
+func (cmd *command) take() []interface{} {
+	cmd.mu.Lock()
+	defer cmd.mu.Unlock()
+	queue := cmd.queue
+	cmd.queue = nil
+	return queue
+}
+
+func (cmd *command) forward() {
+	defer close(cmd.ch)
+	for {
+		cmd.mu.Lock()
+		queue, done := cmd.queue, cmd.done
+		cmd.queue = nil
+		cmd.mu.Unlock()
+
+		for _, r := range queue {
+			select {
+			case cmd.ch <- r:
+			case <-cmd.quit:
+				return
+			}
+		}
+		if done {
+			return
+		}
+		select {
+		case <-cmd.wake:
+		case <-cmd.quit:
+			return
+		}
+	}
+}
+
+// seqSet is a parsed sequence set such as "1:4,7,9:*".
+type seqSet []seqRange
+
+// seqRange is an inclusive range; a range involving "*" is taken as
+// open-ended (hi == 0), since the client can't know what * is.
+type seqRange struct {
+	lo, hi int
+}
+
+func parseSeqSet(s string) (seqSet, bool) {
+	var set seqSet
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, ":", 2)
+		var r seqRange
+		for i, b := range bounds {
+			if b == "*" {
+				r = seqRange{1, 0}
+				break
+			}
+			n, err := strconv.Atoi(b)
+			if err != nil || n <= 0 {
+				return nil, false
+			}
+			if i == 0 {
+				r = seqRange{n, n}
+			} else if n < r.lo {
+				r.lo, r.hi = n, r.lo
+			} else {
+				r.hi = n
+			}
+		}
+		set = append(set, r)
+	}
+	return set, true
+}
+
+func (s seqSet) contains(n int) bool {
+	for _, r := range s {
+		if n >= r.lo && (r.hi == 0 || n <= r.hi) {
+			return true
+		}
+	}
+	return false
+}
+
+// size returns how many numbers the set holds, or -1 if it is
+// open-ended.  Overlapping ranges are counted twice.
+func (s seqSet) size() int {
+	n := 0
+	for _, r := range s {
+		if r.hi == 0 {
+			return -1
+		}
+		n += r.hi - r.lo + 1
+	}
+	return n
+}
+
+// maxExpand is the most numbers expand lists, so that a server can't
+// make the client allocate without bound with a set like 1:4294967295.
+const maxExpand = 1 << 20
+
+// expand lists the numbers in the set.
+func (s seqSet) expand() ([]int, error) {
+	n := s.size()
+	if n < 0 {
+		return nil, errors.New("imap: can't list an open-ended set")
+	}
+	if n > maxExpand {
+		return nil, fmt.Errorf("imap: set of %d numbers is too large to list", n)
+	}
+	ids := make([]int, 0, n)
+	for _, r := range s {
+		for id := r.lo; id <= r.hi; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s seqSet) overlaps(o seqSet) bool {
+	for _, a := range s {
+		for _, b := range o {
+			if (a.hi == 0 || b.lo <= a.hi) && (b.hi == 0 || a.lo <= b.hi) {
+				return true
+			}
+		}
+	}
+	return false
+}
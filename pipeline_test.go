@@ -0,0 +1,139 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeqSet(t *testing.T) {
+	set, ok := parseSeqSet("1:4,7,12:9")
+	if !ok {
+		t.Fatalf("parseSeqSet failed")
+	}
+	for _, n := range []int{1, 4, 7, 9, 12} {
+		if !set.contains(n) {
+			t.Errorf("%v should contain %d", set, n)
+		}
+	}
+	for _, n := range []int{5, 8, 13, 19} {
+		if set.contains(n) {
+			t.Errorf("%v should not contain %d", set, n)
+		}
+	}
+	// The client can't know what "*" is, so "20:*" could mean any
+	// message.
+	if set, _ := parseSeqSet("20:*"); !set.contains(5) || !set.contains(1000) {
+		t.Errorf("%v should contain every message", set)
+	}
+	if _, ok := parseSeqSet("1:x"); ok {
+		t.Errorf("parseSeqSet(1:x) should fail")
+	}
+}
+
+func TestCommandConflicts(t *testing.T) {
+	tests := []struct {
+		pending, next string
+		conflict      bool
+	}{
+		{"STORE 1:5 +FLAGS (\\Seen)", "STORE 6:9 +FLAGS (\\Seen)", false},
+		{"STORE 1:5 +FLAGS (\\Seen)", "STORE 5 +FLAGS (\\Seen)", true},
+		{"UID FETCH 100:200 FLAGS", "UID FETCH 300 FLAGS", false},
+		{"UID FETCH 100:200 FLAGS", "FETCH 300 FLAGS", true},
+		{"FETCH 1:* FLAGS", "FETCH 3 FLAGS", true},
+		{"LIST \"\" \"*\"", "LIST \"\" \"%\"", true},
+		{"LIST \"\" \"*\"", "FETCH 1 FLAGS", true},
+		{"FETCH 1 FLAGS", "LIST \"\" \"*\"", false},
+		{"NOOP", "FETCH 1 FLAGS", true},
+		{"NOOP", "UID FETCH 1 FLAGS", false},
+		{"FETCH 1 FLAGS", "EXAMINE INBOX", true},
+		{"EXAMINE INBOX", "CAPABILITY", true},
+		{"CAPABILITY", "XYZZY", true},
+	}
+	for _, test := range tests {
+		pending := newCommand(test.pending, nil)
+		next := newCommand(test.next, nil)
+		if got := next.conflicts(pending); got != test.conflict {
+			t.Errorf("%q after %q: conflict = %v, want %v", test.next, test.pending, got, test.conflict)
+		}
+	}
+}
+
+func TestPipelinedStore(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	type result struct {
+		fetches []*ResponseFetch
+		err     error
+	}
+	results := make([]chan result, 2)
+	for i, set := range []string{"1:2", "3"} {
+		ch := make(chan result, 1)
+		results[i] = ch
+		set := set
+		go func() {
+			fetches, err := imap.Store(set, StoreAdd, NewFlags(FlagSeen))
+			ch <- result{fetches, err}
+		}()
+		// Keep the tags in order for the script below.
+		srv.expect("a" + string(rune('0'+i)) + " STORE " + set + " +FLAGS (\\Seen)")
+	}
+
+	// Completions and data arrive interleaved and out of order.
+	srv.send(
+		"* 3 FETCH (FLAGS (\\Seen))",
+		"* 1 FETCH (FLAGS (\\Seen))",
+		"a1 OK done",
+		"* 2 FETCH (FLAGS (\\Seen \\Flagged))",
+		"a0 OK done",
+	)
+
+	for i, want := range [][]int{{1, 2}, {3}} {
+		select {
+		case res := <-results[i]:
+			if res.err != nil {
+				t.Fatalf("STORE %d: %s", i, res.err)
+			}
+			if len(res.fetches) != len(want) {
+				t.Fatalf("STORE %d: got %d FETCH responses, want %d", i, len(res.fetches), len(want))
+			}
+			for j, msg := range want {
+				if res.fetches[j].Msg != msg {
+					t.Errorf("STORE %d: response %d is for message %d, want %d", i, j, res.fetches[j].Msg, msg)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("STORE %d did not complete", i)
+		}
+	}
+}
+
+func TestSerialisedCommand(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	first := async(func() error {
+		_, err := imap.SendSync("NOOP")
+		return err
+	})
+	srv.expect("a0 NOOP")
+
+	// FETCH uses sequence numbers, so must wait for the NOOP.
+	second := async(func() error {
+		_, err := imap.Fetch("1", []string{"FLAGS"})
+		return err
+	})
+	select {
+	case err := <-second:
+		t.Fatalf("FETCH completed before NOOP: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	srv.send("* 2 EXPUNGE", "a0 OK done")
+	if err := wait(t, first); err != nil {
+		t.Fatalf("NOOP: %s", err)
+	}
+	srv.expect("a1 FETCH 1 FLAGS")
+	srv.send("* 1 FETCH (FLAGS ())", "a1 OK done")
+	if err := wait(t, second); err != nil {
+		t.Fatalf("FETCH: %s", err)
+	}
+}
@@ -0,0 +1,341 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultMaxPerServer is the Pool connection cap used when none is
+// given.  It's Gmail's limit; other servers are often less generous.
+const DefaultMaxPerServer = 15
+
+// ErrPoolClosed is returned by Get after the pool is closed.
+var ErrPoolClosed = errors.New("imap: pool closed")
+
+// Account says which server a pooled connection is to and who it is
+// logged in as.
+type Account struct {
+	// Server is the host:port to connect to.
+	Server         string
+	User, Password string
+}
+
+// Pool hands out logged-in connections for any number of accounts,
+// keeping connections to each server under a cap.  A connection that
+// is released goes back to the pool to be reused for the same
+// account, preferably by someone wanting the mailbox it has selected.
+// Connections are checked with NOOP before reuse, and discarded once
+// they have failed: after a BYE, a protocol error or a lost
+// connection.
+type Pool struct {
+	// Dial connects to a server and reads its greeting; the pool
+	// logs in.  Nil means DialTLSWith, using TLSConfig and Setup.
+	Dial func(ctx context.Context, server string) (*IMAP, error)
+
+	// TLSConfig and Setup are passed to DialTLSWith when Dial is
+	// nil.  Setup is the place to set KeepAlive, which keeps idle
+	// pooled connections from being dropped.
+	TLSConfig *tls.Config
+	Setup     func(*IMAP)
+
+	// MaxPerServer caps the connections to each server, in use and
+	// idle; zero means DefaultMaxPerServer.
+	MaxPerServer int
+
+	mu      sync.Mutex
+	servers map[string]*poolServer
+	closed  bool
+}
+
+// poolServer is the pool's state for one server.
+type poolServer struct {
+	open int
+	idle []*PoolConn
+
+	// changed is closed, and replaced, whenever a connection is
+	// released or discarded, to wake those waiting for one.
+	changed chan struct{}
+}
+
+func (s *poolServer) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// PoolConn is a connection from a Pool.  Release it when done.
+type PoolConn struct {
+	*IMAP
+	Account Account
+
+	pool *Pool
+
+	// idle is set while the connection is in the pool, gone once
+	// it has been discarded.  Both are guarded by the pool's mu.
+	idle, gone bool
+	idleAt     time.Time
+}
+
+// Get returns a connection logged in to account with mailbox
+// selected, or none selected if mailbox is empty.  It waits, until ctx
+// is done, while the server's cap is reached.  An idle connection of
+// another account on the same server is logged out to make room.
+func (p *Pool) Get(ctx context.Context, account Account, mailbox string) (*PoolConn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		s := p.server(account.Server)
+
+		if c := s.take(account, mailbox); c != nil {
+			p.mu.Unlock()
+			if err := c.prepare(ctx, mailbox); err != nil {
+				if c.discarded() && ctx.Err() == nil {
+					// Try another.
+					continue
+				}
+				// The mailbox can't be selected; the
+				// connection is fine.
+				c.Release()
+				return nil, err
+			}
+			return c, nil
+		}
+
+		if s.open < p.max() {
+			s.open++
+			p.mu.Unlock()
+			c, err := p.connect(ctx, account)
+			if err == nil {
+				err = c.prepare(ctx, mailbox)
+			}
+			if err != nil {
+				if c != nil {
+					// Discarded unless it's only the
+					// mailbox that was refused.
+					c.Release()
+				} else {
+					p.mu.Lock()
+					s.open--
+					s.signal()
+					p.mu.Unlock()
+				}
+				return nil, err
+			}
+			return c, nil
+		}
+
+		if len(s.idle) > 0 {
+			// All idle connections are someone else's.
+			victim := s.idle[0]
+			s.idle = s.idle[1:]
+			victim.idle = false
+			p.mu.Unlock()
+			go victim.logout()
+			continue
+		}
+
+		changed := s.changed
+		p.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *Pool) max() int {
+	if p.MaxPerServer > 0 {
+		return p.MaxPerServer
+	}
+	return DefaultMaxPerServer
+}
+
+// server returns the state for a server.  Called with mu held.
+func (p *Pool) server(addr string) *poolServer {
+	if p.servers == nil {
+		p.servers = make(map[string]*poolServer)
+	}
+	s := p.servers[addr]
+	if s == nil {
+		s = &poolServer{changed: make(chan struct{})}
+		p.servers[addr] = s
+	}
+	return s
+}
+
+// take removes and returns the best idle connection for account: one
+// with mailbox already selected if there is one.  Called with the
+// pool's mu held.
+func (s *poolServer) take(account Account, mailbox string) *PoolConn {
+	best := -1
+	for i, c := range s.idle {
+		if c.Account != account {
+			continue
+		}
+		if best < 0 {
+			best = i
+		}
+		if c.Mailbox().Snapshot().Name == mailbox {
+			best = i
+			break
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	c := s.idle[best]
+	s.idle = append(s.idle[:best], s.idle[best+1:]...)
+	c.idle = false
+	return c
+}
+
+// connect dials and logs in.
+func (p *Pool) connect(ctx context.Context, account Account) (*PoolConn, error) {
+	imap, err := account.connect(ctx, dialFunc(p.Dial, p.TLSConfig, p.Setup))
+	if err != nil {
+		return nil, err
+	}
+	return &PoolConn{IMAP: imap, Account: account, pool: p}, nil
+}
+
+// connect dials the account's server with dial and logs in unless
+// the server did that already.
+func (account Account) connect(ctx context.Context, dial func(context.Context, string) (*IMAP, error)) (*IMAP, error) {
+	imap, err := dial(ctx, account.Server)
+	if err != nil {
+		return nil, err
+	}
+	if imap.State() == StateNotAuthenticated {
+		if _, _, err := imap.AuthContext(ctx, account.User, account.Password); err != nil {
+			imap.Close()
+			return nil, err
+		}
+	}
+	return imap, nil
+}
+
+// prepare checks that a connection works and selects mailbox on it.
+// The connection is discarded if it doesn't work.
+func (c *PoolConn) prepare(ctx context.Context, mailbox string) error {
+	if !c.idleAt.IsZero() {
+		// It's been idle; make sure it's still there.
+		if err := c.NoopContext(ctx); err != nil {
+			c.discard()
+			return err
+		}
+	}
+	if c.Mailbox().Snapshot().Name == mailbox {
+		return nil
+	}
+	if mailbox == "" {
+		return c.deselect(ctx)
+	}
+	_, err := c.SelectContext(ctx, mailbox)
+	if err != nil {
+		var imapErr *IMAPError
+		if !errors.As(err, &imapErr) {
+			c.discard()
+		}
+	}
+	return err
+}
+
+// deselect leaves the selected mailbox without expunging it: with
+// UNSELECT, or with CLOSE if the mailbox was examined.  Failing
+// those, the connection is discarded, and Get uses another.
+func (c *PoolConn) deselect(ctx context.Context) error {
+	unselect, err := c.supports(ctx, "UNSELECT")
+	if err == nil {
+		switch {
+		case unselect:
+			_, err = c.SendSyncContext(ctx, "UNSELECT")
+		case c.Mailbox().Snapshot().ReadOnly:
+			_, err = c.SendSyncContext(ctx, "CLOSE")
+		default:
+			err = errors.New("imap: can't leave the mailbox without UNSELECT")
+		}
+	}
+	if err != nil {
+		c.discard()
+	}
+	return err
+}
+
+// Release returns the connection to the pool, or discards it if it
+// has failed.  The connection must not be used afterwards.
+func (c *PoolConn) Release() {
+	p := c.pool
+	p.mu.Lock()
+	if c.idle || c.gone {
+		p.mu.Unlock()
+		return
+	}
+	if p.closed || c.Err() != nil {
+		p.mu.Unlock()
+		c.discard()
+		return
+	}
+	c.idle = true
+	c.idleAt = time.Now()
+	s := p.server(c.Account.Server)
+	s.idle = append(s.idle, c)
+	s.signal()
+	p.mu.Unlock()
+}
+
+// discard closes the connection and frees its place in the pool.
+func (c *PoolConn) discard() {
+	p := c.pool
+	p.mu.Lock()
+	if c.gone {
+		p.mu.Unlock()
+		return
+	}
+	c.gone = true
+	s := p.server(c.Account.Server)
+	s.open--
+	s.signal()
+	p.mu.Unlock()
+	c.Close()
+}
+
+func (c *PoolConn) discarded() bool {
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+	return c.gone
+}
+
+// logout ends an idle connection the pool no longer wants.
+func (c *PoolConn) logout() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.LogoutContext(ctx)
+	c.discard()
+}
+
+// Close closes the idle connections and stops the pool handing out
+// more.  Connections in use are closed when released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	var idle []*PoolConn
+	for _, s := range p.servers {
+		for _, c := range s.idle {
+			c.idle = false
+			idle = append(idle, c)
+		}
+		s.idle = nil
+	}
+	p.mu.Unlock()
+
+	for _, c := range idle {
+		c.logout()
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServers is a Pool.Dial that connects to scripted servers, and
+// logs the commands they receive as "conn: command".
+type fakeServers struct {
+	t *testing.T
+
+	// reply, if set, answers commands before the defaults; nil
+	// means no answer of its own.
+	reply func(conn int, tag, cmd string) []string
+
+	mu   sync.Mutex
+	log  []string
+	srvs []*testServer
+}
+
+func (f *fakeServers) dial(ctx context.Context, server string) (*IMAP, error) {
+	imap, srv := newTestConn(f.t)
+	f.mu.Lock()
+	f.srvs = append(f.srvs, srv)
+	n := len(f.srvs)
+	f.mu.Unlock()
+
+	go func() {
+		srv.send("* OK ready")
+		srv.serve(func(tag, cmd string) []string {
+			f.mu.Lock()
+			f.log = append(f.log, fmt.Sprintf("%d: %s", n, cmd))
+			f.mu.Unlock()
+			if f.reply != nil {
+				if lines := f.reply(n, tag, cmd); lines != nil {
+					return lines
+				}
+			}
+			switch {
+			case strings.HasPrefix(cmd, "SELECT "):
+				if strings.Contains(cmd, "Missing") {
+					return []string{tag + " NO no such mailbox"}
+				}
+				return []string{"* 1 EXISTS", tag + " OK [READ-WRITE] done"}
+			case cmd == "LOGOUT":
+				return []string{"* BYE bye", tag + " OK done"}
+			case cmd == "CAPABILITY":
+				return []string{"* CAPABILITY IMAP4rev1", tag + " OK done"}
+			}
+			return []string{tag + " OK done"}
+		})
+	}()
+	_, err := imap.Start()
+	return imap, err
+}
+
+// takeLog returns the commands logged since the last call.
+func (f *fakeServers) takeLog() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log := strings.Join(f.log, "; ")
+	f.log = nil
+	return log
+}
+
+var (
+	alice = Account{Server: "mail:993", User: "alice", Password: "pw"}
+	bob   = Account{Server: "mail:993", User: "bob", Password: "pw"}
+)
+
+func TestPoolReuse(t *testing.T) {
+	f := &fakeServers{t: t}
+	p := &Pool{Dial: f.dial}
+	defer p.Close()
+	ctx := context.Background()
+
+	inbox, err := p.Get(ctx, alice, "INBOX")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	sent, err := p.Get(ctx, alice, "Sent")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if got, want := f.takeLog(), `1: LOGIN alice pw; 1: CAPABILITY; 1: SELECT "INBOX"; 2: LOGIN alice pw; 2: CAPABILITY; 2: SELECT "Sent"`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+	inbox.Release()
+	sent.Release()
+
+	// The connection with Sent selected is picked, and checked.
+	c, err := p.Get(ctx, alice, "Sent")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if c.IMAP != sent.IMAP {
+		t.Errorf("got a different connection")
+	}
+	if got, want := f.takeLog(), `2: NOOP`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+
+	// A mailbox that can't be selected leaves the connection usable.
+	if _, err := p.Get(ctx, alice, "Missing"); err == nil {
+		t.Errorf("Get of missing mailbox succeeded")
+	}
+	if got, want := f.takeLog(), `1: NOOP; 1: SELECT "Missing"`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+	c.Release()
+
+	// Asking for no mailbox picks the connection with none selected.
+	if _, err := p.Get(ctx, alice, ""); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if got, want := f.takeLog(), `1: NOOP`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+	if len(f.srvs) != 2 {
+		t.Errorf("dialled %d times, want 2", len(f.srvs))
+	}
+}
+
+func TestPoolDeselect(t *testing.T) {
+	f := &fakeServers{t: t}
+	f.reply = func(conn int, tag, cmd string) []string {
+		if cmd == "CAPABILITY" && conn == 1 {
+			return []string{"* CAPABILITY IMAP4rev1 UNSELECT", tag + " OK done"}
+		}
+		return nil
+	}
+	p := &Pool{Dial: f.dial, MaxPerServer: 1}
+	defer p.Close()
+	ctx := context.Background()
+
+	// A reused connection has its mailbox unselected, not closed,
+	// which would expunge it.
+	c, err := p.Get(ctx, alice, "INBOX")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	c.Release()
+	if c, err = p.Get(ctx, alice, ""); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if name := c.Mailbox().Snapshot().Name; name != "" {
+		t.Errorf("mailbox %q selected", name)
+	}
+	if got, want := f.takeLog(), `1: LOGIN alice pw; 1: CAPABILITY; 1: SELECT "INBOX"; 1: NOOP; 1: UNSELECT`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+
+	// Without UNSELECT, a connection with a mailbox selected
+	// read-write is given up for a new one.
+	c.Release()
+	if c, err = p.Get(ctx, bob, "INBOX"); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	c.Release()
+	f.takeLog()
+	if c, err = p.Get(ctx, bob, ""); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if name := c.Mailbox().Snapshot().Name; name != "" {
+		t.Errorf("mailbox %q selected", name)
+	}
+	if got, want := f.takeLog(), `2: NOOP; `; !strings.HasPrefix(got, want) || !strings.Contains(got, "3: LOGIN bob pw") {
+		t.Errorf("log %q, want %q then a new connection", got, want)
+	}
+}
+
+func TestPoolCap(t *testing.T) {
+	f := &fakeServers{t: t}
+	p := &Pool{Dial: f.dial, MaxPerServer: 1}
+	defer p.Close()
+
+	a, err := p.Get(context.Background(), alice, "")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx, bob, ""); err != context.DeadlineExceeded {
+		t.Fatalf("Get over the cap: got %v, want DeadlineExceeded", err)
+	}
+
+	// Once alice is done, her idle connection makes way for bob.
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Get(context.Background(), bob, "")
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	a.Release()
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if got, want := f.takeLog(), `1: LOGIN alice pw; 1: CAPABILITY; 1: LOGOUT; 2: LOGIN bob pw; 2: CAPABILITY`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+}
+
+func TestPoolDiscardsAfterBye(t *testing.T) {
+	f := &fakeServers{t: t}
+	p := &Pool{Dial: f.dial, MaxPerServer: 1}
+	defer p.Close()
+
+	c, err := p.Get(context.Background(), alice, "")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	f.srvs[0].send("* BYE shutting down")
+	for c.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	c.Release()
+
+	c2, err := p.Get(context.Background(), alice, "")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if c2.IMAP == c.IMAP || len(f.srvs) != 2 {
+		t.Errorf("dead connection was reused")
+	}
+}
+
+func TestPoolKeepAlive(t *testing.T) {
+	// A TLS server, as the pool's own dialler wants.
+	https := httptest.NewTLSServer(nil)
+	cert := https.TLS.Certificates[0]
+	roots := x509.NewCertPool()
+	roots.AddCert(https.Certificate())
+	https.Close()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+	defer l.Close()
+
+	noops := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		srv := &testServer{t, conn, bufio.NewReader(conn)}
+		srv.send("* OK [CAPABILITY IMAP4rev1] ready")
+		srv.serve(func(tag, cmd string) []string {
+			switch cmd {
+			case "NOOP":
+				noops <- tag
+			case "CAPABILITY":
+				return []string{"* CAPABILITY IMAP4rev1", tag + " OK done"}
+			}
+			return []string{tag + " OK done"}
+		})
+	}()
+
+	p := &Pool{
+		TLSConfig: &tls.Config{RootCAs: roots},
+		Setup:     func(imap *IMAP) { imap.KeepAlive = 20 * time.Millisecond },
+	}
+	defer p.Close()
+	c, err := p.Get(context.Background(), Account{Server: l.Addr().String(), User: "alice", Password: "pw"}, "")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	c.Release()
+
+	// Left idle in the pool, the connection keeps itself alive.
+	for i := 0; i < 2; i++ {
+		select {
+		case <-noops:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no NOOP while idle")
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Status represents server status codes which are returned by
@@ -43,12 +45,48 @@ func (r *ResponseStatus) String() string {
 type IMAPError struct {
 	Status Status
 	Text   string
+
+	// Code is the response code, as in "TRYCREATE", or nil.  Some
+	// codes make the error match a sentinel with errors.Is, such
+	// as [OVERQUOTA] ErrOverQuota.
+	Code interface{}
 }
 
 func (e *IMAPError) Error() string {
 	return fmt.Sprintf("imap: %s %s", e.Status, e.Text)
 }
 
+// Is reports whether the error's response code is the one target
+// stands for.
+func (e *IMAPError) Is(target error) bool {
+	switch target {
+	case ErrOverQuota:
+		return e.Code == "OVERQUOTA"
+	}
+	cond, _, ok := parseMetadataCode(e.Code)
+	switch target {
+	case ErrMetadataMaxSize:
+		return ok && cond == "MAXSIZE"
+	case ErrMetadataTooMany:
+		return ok && cond == "TOOMANY"
+	case ErrMetadataNoPrivate:
+		return ok && cond == "NOPRIVATE"
+	}
+	return false
+}
+
+// ErrServerBye is the error returned for commands that were pending,
+// or are issued, after the server closed the session with an
+// unsolicited BYE.
+type ErrServerBye struct {
+	Code interface{}
+	Text string
+}
+
+func (e *ErrServerBye) Error() string {
+	return fmt.Sprintf("imap: server said BYE: %s", e.Text)
+}
+
 const (
 	WildcardAny          = "%"
 	WildcardAnyRecursive = "*"
@@ -65,6 +103,7 @@ type reader struct {
 
 // Read a full response (e.g. "* OK foobar\r\n").
 func (r *reader) readResponse() (tag, interface{}, error) {
+	r.startLine()
 	tag, err := r.readTag()
 	if err != nil {
 		return untagged, nil, err
@@ -124,7 +163,7 @@ func (r *reader) readTag() (tag, error) {
 // ResponsePermanentFlags contains the flags the client can change
 // permanently.
 type ResponsePermanentFlags struct {
-	Flags []string
+	Flags Flags
 }
 
 // ResponseUIDValidity contains the unique identifier validity value.
@@ -139,6 +178,12 @@ type ResponseUIDNext struct {
 	Value int
 }
 
+// ResponseHighestModSeq contains the highest mod-sequence of a
+// mailbox.  See RFC 7162 section 3.1.2.1.
+type ResponseHighestModSeq struct {
+	Value uint64
+}
+
 // Read a status response, one starting with OK/NO/BAD.
 func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr error) {
 	defer func() {
@@ -168,9 +213,15 @@ func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr erro
 		panic(fmt.Errorf("unexpected status %q", statusStr))
 	}
 
+	code, rest := r.readRespText()
+	return &ResponseStatus{status, code, rest, nil}, nil
+}
+
+// Read the resp-text following a status: an optional bracketed
+// response code, then text up to the end of the line.
+func (r *reader) readRespText() (code interface{}, text string) {
 	peek, err := r.ReadByte()
 	check(err)
-	var code interface{}
 	if peek != '[' {
 		r.UnreadByte()
 	} else {
@@ -182,7 +233,7 @@ func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr erro
 			/* "PERMANENTFLAGS" SP "(" [flag-perm *(SP flag-perm)] ")" */
 			flags, err := r.readParenStringList()
 			check(err)
-			code = &ResponsePermanentFlags{flags}
+			code = &ResponsePermanentFlags{flagsFromStrings(flags)}
 			check(r.expect("] "))
 		case "UIDVALIDITY":
 			num, err := r.readNumber()
@@ -194,6 +245,25 @@ func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr erro
 			check(err)
 			code = &ResponseUIDNext{num}
 			check(r.expect("] "))
+		case "HIGHESTMODSEQ":
+			num, err := r.readNumber64()
+			check(err)
+			code = &ResponseHighestModSeq{num}
+			check(r.expect("] "))
+		case "CAPABILITY":
+			list, err := r.ReadString(']')
+			check(err)
+			code = &ResponseCapabilities{strings.Fields(list[:len(list)-1])}
+			if c, err := r.ReadByte(); err == nil && c != ' ' {
+				r.UnreadByte()
+			}
+		case "MODIFIED":
+			set, err := r.ReadString(']')
+			check(err)
+			code = &ResponseModified{set[:len(set)-1]}
+			if c, err := r.ReadByte(); err == nil && c != ' ' {
+				r.UnreadByte()
+			}
 		default:
 			text, err := r.ReadString(']')
 			check(err)
@@ -202,6 +272,9 @@ func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr erro
 			} else {
 				code = codeStr
 			}
+			if c, err := r.ReadByte(); err == nil && c != ' ' {
+				r.UnreadByte()
+			}
 		}
 
 		/*
@@ -217,10 +290,30 @@ func (r *reader) readStatus(statusStr string) (resp *ResponseStatus, outErr erro
 		*/
 	}
 
-	rest, err := r.readToEOL()
+	text, err = r.readToEOL()
 	check(err)
 
-	return &ResponseStatus{status, code, rest, nil}, nil
+	return code, text
+}
+
+// ResponseModified is the MODIFIED code of a STORE with
+// UNCHANGEDSINCE (RFC 7162): the messages that weren't updated.
+type ResponseModified struct {
+	Messages string
+}
+
+// ResponseBye is an untagged BYE: the server is about to close the
+// connection.
+type ResponseBye struct {
+	Code interface{}
+	Text string
+}
+
+// ResponsePreauth is a PREAUTH greeting: the connection is already
+// authenticated.
+type ResponsePreauth struct {
+	Code interface{}
+	Text string
 }
 
 // ResponseCapabilities contains the server capability list from a
@@ -229,6 +322,188 @@ type ResponseCapabilities struct {
 	Capabilities []string
 }
 
+// ResponseEnabled lists the extensions an ENABLE turned on.
+type ResponseEnabled struct {
+	Capabilities []string
+}
+
+// ResponseSearch is a SEARCH response: the matching messages, and
+// with CONDSTORE, the highest mod-sequence among them.
+type ResponseSearch struct {
+	IDs    []int
+	ModSeq uint64
+}
+
+func (r *reader) readSEARCH() *ResponseSearch {
+	// *(SP nz-number) [SP "(" "MODSEQ" SP mod-sequence-value ")"]
+	search := &ResponseSearch{IDs: []int{}}
+	for {
+		c, err := r.ReadByte()
+		check(err)
+		check(r.UnreadByte())
+		switch {
+		case c == '\r':
+			check(r.expectEOL())
+			return search
+		case c == '(':
+			s, err := r.readSexp()
+			check(err)
+			if len(s) == 2 && s[0] == "MODSEQ" {
+				search.ModSeq, err = strconv.ParseUint(s[1].(string), 10, 64)
+				check(err)
+			}
+		case c >= '0' && c <= '9':
+			num, err := r.readNumber()
+			check(err)
+			search.IDs = append(search.IDs, num)
+		default:
+			panic(fmt.Errorf("unexpected %q in SEARCH response", c))
+		}
+		if c, err := r.ReadByte(); err == nil && c != ' ' {
+			r.UnreadByte()
+		}
+	}
+}
+
+// ResponseESearch is an ESEARCH response (RFC 4731), which IMAP4rev2
+// sends in place of SEARCH.  Tag is that of the command it answers,
+// UID says whether the numbers are UIDs, and All is the set of the
+// matching messages, as in "1:3,7".  Only the items asked for with
+// RETURN are present; without RETURN, that is All.
+type ResponseESearch struct {
+	Tag             string
+	UID             bool
+	Min, Max, Count int
+	All             string
+	ModSeq          uint64
+}
+
+// IDs returns the numbers in All.  It fails if All holds too many to
+// list; Contains tests one number at no such cost.
+func (r *ResponseESearch) IDs() ([]int, error) {
+	if r.All == "" {
+		return []int{}, nil
+	}
+	set, ok := parseSeqSet(r.All)
+	if !ok {
+		return nil, fmt.Errorf("imap: bad set %q", r.All)
+	}
+	return set.expand()
+}
+
+// Contains reports whether id is in All.
+func (r *ResponseESearch) Contains(id int) bool {
+	set, _ := parseSeqSet(r.All)
+	return set.contains(id)
+}
+
+func (r *reader) readESEARCH() *ResponseESearch {
+	// [search-correlator] [SP "UID"] *(SP search-return-data)
+	esearch := &ResponseESearch{}
+	for {
+		c, err := r.ReadByte()
+		check(err)
+		check(r.UnreadByte())
+		if c == '\r' {
+			check(r.expectEOL())
+			return esearch
+		}
+		if c == '(' {
+			s, err := r.readSexp()
+			check(err)
+			if len(s) == 2 && s[0] == "TAG" {
+				esearch.Tag, _ = s[1].(string)
+			}
+		} else {
+			key, err := r.readToken()
+			check(err)
+			if strings.EqualFold(key, "UID") {
+				esearch.UID = true
+				continue
+			}
+			var value string
+			if c, err := r.ReadByte(); err == nil {
+				check(r.UnreadByte())
+				if c == '(' {
+					// An extension's data; skip it.
+					_, err = r.readSexp()
+					check(err)
+					if c, err := r.ReadByte(); err == nil && c != ' ' {
+						r.UnreadByte()
+					}
+				} else {
+					value, err = r.readToken()
+					check(err)
+				}
+			}
+			switch strings.ToUpper(key) {
+			case "MIN":
+				esearch.Min, err = strconv.Atoi(value)
+			case "MAX":
+				esearch.Max, err = strconv.Atoi(value)
+			case "COUNT":
+				esearch.Count, err = strconv.Atoi(value)
+			case "ALL":
+				if _, ok := parseSeqSet(value); !ok || strings.Contains(value, "*") {
+					panic(fmt.Errorf("bad set %q in ESEARCH response", value))
+				}
+				esearch.All = value
+			case "MODSEQ":
+				esearch.ModSeq, err = strconv.ParseUint(value, 10, 64)
+			}
+			check(err)
+			continue
+		}
+		if c, err := r.ReadByte(); err == nil && c != ' ' {
+			r.UnreadByte()
+		}
+	}
+}
+
+// ResponseVanished is a VANISHED response (RFC 7162), which replaces
+// EXPUNGE once QRESYNC is enabled: the messages with the UIDs in Set,
+// as in "41,43:116", were expunged.  Earlier means they were expunged
+// before the command that reported them, so they aren't counted in
+// EXISTS any more.
+type ResponseVanished struct {
+	Earlier bool
+	Set     string
+}
+
+// UIDs returns the UIDs in Set.  It fails if Set is malformed or
+// holds too many to list; Contains tests one UID at no such cost.
+func (r *ResponseVanished) UIDs() ([]int, error) {
+	set, ok := parseSeqSet(r.Set)
+	if !ok {
+		return nil, fmt.Errorf("imap: bad UID set %q", r.Set)
+	}
+	return set.expand()
+}
+
+// Contains reports whether uid is in Set.
+func (r *ResponseVanished) Contains(uid int) bool {
+	set, _ := parseSeqSet(r.Set)
+	return set.contains(uid)
+}
+
+func (r *reader) readVANISHED() *ResponseVanished {
+	// ["(EARLIER)" SP] known-uids
+	vanished := &ResponseVanished{}
+	c, err := r.ReadByte()
+	check(err)
+	check(r.UnreadByte())
+	if c == '(' {
+		check(r.expect("(EARLIER) "))
+		vanished.Earlier = true
+	}
+	vanished.Set, err = r.readToEOL()
+	check(err)
+	if _, ok := parseSeqSet(vanished.Set); !ok || strings.Contains(vanished.Set, "*") {
+		panic(fmt.Errorf("bad UID set %q in VANISHED response", vanished.Set))
+	}
+	return vanished
+}
+
 func (r *reader) readCAPABILITY() *ResponseCapabilities {
 	caps := make([]string, 0)
 	for {
@@ -243,38 +518,118 @@ func (r *reader) readCAPABILITY() *ResponseCapabilities {
 	return &ResponseCapabilities{caps}
 }
 
-// ResponseList contains the list metadata from a LIST message.
+// ResponseList is a LIST response.  Attributes holds every attribute
+// as sent, including those without a field of their own.  OldName is
+// set when the response reports a rename (RFC 5465).
 type ResponseList struct {
 	Inferiors,
 	Selectable,
 	Marked,
 	Children *bool
-	Delim string
-	Name  string
+	Attributes []string
+	Delim      string
+	Name       string
+	OldName    string
+
+	// ChildInfo lists the selection options, such as SUBSCRIBED,
+	// that children of the mailbox matched (RECURSIVEMATCH), and
+	// Status holds the items asked for with ListReturnStatus.
+	ChildInfo []string
+	Status    map[string]uint64
+}
+
+// HasAttribute reports whether the mailbox has the attribute, as in
+// HasAttribute(`\Subscribed`).
+func (l *ResponseList) HasAttribute(attr string) bool {
+	return hasCapability(l.Attributes, attr)
+}
+
+// Special-use attributes of mailboxes (RFC 6154).
+const (
+	SpecialUseAll     = `\All`
+	SpecialUseArchive = `\Archive`
+	SpecialUseDrafts  = `\Drafts`
+	SpecialUseFlagged = `\Flagged`
+	SpecialUseJunk    = `\Junk`
+	SpecialUseSent    = `\Sent`
+	SpecialUseTrash   = `\Trash`
+)
+
+// SpecialUse returns the mailbox's special-use attribute, such as
+// SpecialUseSent, or "" if it has none.
+func (l *ResponseList) SpecialUse() string {
+	for _, use := range []string{SpecialUseAll, SpecialUseArchive, SpecialUseDrafts,
+		SpecialUseFlagged, SpecialUseJunk, SpecialUseSent, SpecialUseTrash} {
+		if l.HasAttribute(use) {
+			return use
+		}
+	}
+	return ""
 }
 
 func (r *reader) readLIST() *ResponseList {
 	// "(" [mbx-list-flags] ")" SP (DQUOTE QUOTED-CHAR DQUOTE / nil) SP mailbox
+	//   [SP mbox-list-extended]
 	flags, err := r.readParenStringList()
 	check(err)
 	r.expect(" ")
 
-	delim, err := r.readQuoted()
+	var delim string
+	c, err := r.ReadByte()
 	check(err)
+	check(r.UnreadByte())
+	if c == '"' {
+		delim, err = r.readQuoted()
+		check(err)
+	} else {
+		check(r.expect("NIL"))
+	}
 	r.expect(" ")
 
-	name, err := r.readQuoted()
+	name, err := r.readAString()
 	check(err)
 
+	list := &ResponseList{Attributes: flags, Delim: delim, Name: name}
+
+	c, err = r.ReadByte()
+	check(err)
+	if c == ' ' {
+		// ("OLDNAME" ("old name")), ("CHILDINFO" ("SUBSCRIBED"))
+		// and the like.
+		ext, err := r.readSexp()
+		check(err)
+		for i := 0; i+1 < len(ext); i += 2 {
+			tag, _ := ext[i].(string)
+			value, ok := ext[i+1].([]sexp)
+			if !ok {
+				continue
+			}
+			switch strings.ToUpper(tag) {
+			case "OLDNAME":
+				if len(value) > 0 {
+					if old, ok := value[0].(string); ok {
+						list.OldName = old
+					}
+				}
+			case "CHILDINFO":
+				for _, v := range value {
+					if info, ok := v.(string); ok {
+						list.ChildInfo = append(list.ChildInfo, info)
+					}
+				}
+			}
+		}
+	} else {
+		check(r.UnreadByte())
+	}
 	check(r.expectEOL())
 
-	list := &ResponseList{Delim: string(delim), Name: string(name)}
 	for _, flag := range flags {
 		switch flag {
 		case "\\Noinferiors":
 			b := false
 			list.Inferiors = &b
-		case "\\Noselect":
+		case "\\Noselect", "\\NonExistent":
 			b := false
 			list.Selectable = &b
 		case "\\Marked":
@@ -289,23 +644,47 @@ func (r *reader) readLIST() *ResponseList {
 		case "\\HasNoChildren":
 			b := false
 			list.Children = &b
-		default:
-			panic(fmt.Sprintf("unknown list flag %q", flag))
 		}
 	}
 	return list
 }
 
+// ResponseMailboxStatus is a STATUS response.  Items maps the names of
+// the items the server reported (MESSAGES, UIDNEXT, UNSEEN, ...) to
+// their values.
+type ResponseMailboxStatus struct {
+	Mailbox string
+	Items   map[string]uint64
+}
+
+func (r *reader) readSTATUS() *ResponseMailboxStatus {
+	// mailbox SP "(" [status-att-list] ")"
+	name, err := r.readAString()
+	check(err)
+	check(r.expect(" "))
+	atts, err := r.readParenStringList()
+	check(err)
+	check(r.expectEOL())
+
+	status := &ResponseMailboxStatus{Mailbox: name, Items: make(map[string]uint64)}
+	for i := 0; i+1 < len(atts); i += 2 {
+		value, err := strconv.ParseUint(atts[i+1], 10, 64)
+		check(err)
+		status.Items[strings.ToUpper(atts[i])] = value
+	}
+	return status
+}
+
 // ResponseFlags contains the mailbox flags from a FLAGS message.
 type ResponseFlags struct {
-	Flags []string
+	Flags Flags
 }
 
 func (r *reader) readFLAGS() *ResponseFlags {
 	flags, err := r.readParenStringList()
 	check(err)
 	check(r.expectEOL())
-	return &ResponseFlags{flags}
+	return &ResponseFlags{flagsFromStrings(flags)}
 }
 
 // ResponseFetchEnvelope contains the broken-down message metadata
@@ -313,63 +692,166 @@ func (r *reader) readFLAGS() *ResponseFlags {
 type ResponseFetchEnvelope struct {
 	Date, Subject, InReplyTo, MessageId *string
 	From, Sender, ReplyTo, To, Cc, Bcc  []Address
+
+	// Subject has its RFC 2047 encoded words decoded; RawSubject
+	// is the subject as sent by the server.
+	RawSubject *string
+
+	// Time is Date parsed with ParseDate, or the zero time if the
+	// date was missing or unparseable.
+	Time time.Time
 }
 
 // ResponseFetch contains the message data from a FETCH message.
 type ResponseFetch struct {
 	Msg                  int
-	Flags                sexp
+	UID                  int
+	Flags                Flags
 	Envelope             ResponseFetchEnvelope
 	InternalDate         string
 	Size                 int
 	Rfc822, Rfc822Header []byte
+	ModSeq               uint64
+
+	// Body holds the BODY[section] and BINARY[section] items by
+	// name in FetchSection's canonical form, as in "BODY[TEXT]",
+	// "BODY[HEADER.FIELDS (FROM)]" or "BINARY[1]<0>"; BODY[] and
+	// BODY[HEADER], which IMAP4rev2 uses in place of RFC822 and
+	// RFC822.HEADER, also fill in Rfc822 and Rfc822Header.
+	// BinarySize holds the BINARY.SIZE[section] items.
+	Body       map[string][]byte
+	BinarySize map[string]int
+
+	// InternalTime is InternalDate parsed with ParseInternalDate, or
+	// the zero time if it was missing or unparseable.
+	InternalTime time.Time
 }
 
-func (r *reader) readFETCH(num int) *ResponseFetch {
-	s, err := r.readSexp()
-	check(err)
-	if len(s)%2 != 0 {
-		panic("fetch sexp must have even number of items")
+func (f *ResponseFetch) setBody(key string, data []byte) {
+	if f.Body == nil {
+		f.Body = make(map[string][]byte)
+	}
+	f.Body[key] = data
+}
+
+// fetchBytes returns the value of a message data item, sent as a
+// literal, a quoted string or NIL.
+func fetchBytes(s sexp) []byte {
+	switch s := s.(type) {
+	case []byte:
+		return s
+	case string:
+		return []byte(s)
 	}
+	return nil
+}
+
+func (r *reader) readFETCH(num int) *ResponseFetch {
+	// "(" msg-att *(SP msg-att) ")", read an item at a time since
+	// BODY[HEADER.FIELDS (FROM)] and the like aren't atoms.
+	check(r.expect("("))
 	fetch := &ResponseFetch{Msg: num}
-	for i := 0; i < len(s); i += 2 {
-		key := s[i].(string)
-		switch key {
-		case "ENVELOPE":
-			env := s[i+1].([]sexp)
-			// This format is insane.
-			if len(env) != 10 {
-				panic(fmt.Sprintf("envelope needed 10 fields, had %d", len(env)))
-			}
-			fetch.Envelope.Date = nilOrString(env[0])
-			fetch.Envelope.Subject = nilOrString(env[1])
-			fetch.Envelope.From = addressListFromSexp(env[2])
-			fetch.Envelope.Sender = addressListFromSexp(env[3])
-			fetch.Envelope.ReplyTo = addressListFromSexp(env[4])
-			fetch.Envelope.To = addressListFromSexp(env[5])
-			fetch.Envelope.Cc = addressListFromSexp(env[6])
-			fetch.Envelope.Bcc = addressListFromSexp(env[7])
-			fetch.Envelope.InReplyTo = nilOrString(env[8])
-			fetch.Envelope.MessageId = nilOrString(env[9])
-		case "FLAGS":
-			fetch.Flags = s[i+1]
-		case "INTERNALDATE":
-			fetch.InternalDate = s[i+1].(string)
-		case "RFC822":
-			fetch.Rfc822 = s[i+1].([]byte)
-		case "RFC822.HEADER":
-			fetch.Rfc822Header = s[i+1].([]byte)
-		case "RFC822.SIZE":
-			fetch.Size, err = strconv.Atoi(s[i+1].(string))
-			check(err)
-		default:
-			panic(fmt.Sprintf("unhandled fetch key %#v", key))
+	for {
+		c, err := r.ReadByte()
+		check(err)
+		if c == ')' {
+			break
+		}
+		check(r.UnreadByte())
+
+		key, err := r.readFetchKey()
+		check(err)
+		check(r.expect(" "))
+		value, err := r.readSexpItem()
+		check(err)
+		fetch.set(key, value)
+
+		c, err = r.ReadByte()
+		check(err)
+		if c != ' ' {
+			check(r.UnreadByte())
 		}
 	}
 	check(r.expectEOL())
 	return fetch
 }
 
+// set fills in a fetch item.  It panics with an error on a bad one.
+func (fetch *ResponseFetch) set(key string, value sexp) {
+	var err error
+	switch key {
+	case "ENVELOPE":
+		env := value.([]sexp)
+		// This format is insane.
+		if len(env) != 10 {
+			panic(fmt.Errorf("envelope needed 10 fields, had %d", len(env)))
+		}
+		fetch.Envelope.Date = nilOrString(env[0])
+		if fetch.Envelope.Date != nil {
+			fetch.Envelope.Time, _ = ParseDate(*fetch.Envelope.Date)
+		}
+		fetch.Envelope.RawSubject = nilOrString(env[1])
+		if raw := fetch.Envelope.RawSubject; raw != nil {
+			subject := decodeHeader(*raw)
+			fetch.Envelope.Subject = &subject
+		}
+		fetch.Envelope.From = addressListFromSexp(env[2])
+		fetch.Envelope.Sender = addressListFromSexp(env[3])
+		fetch.Envelope.ReplyTo = addressListFromSexp(env[4])
+		fetch.Envelope.To = addressListFromSexp(env[5])
+		fetch.Envelope.Cc = addressListFromSexp(env[6])
+		fetch.Envelope.Bcc = addressListFromSexp(env[7])
+		fetch.Envelope.InReplyTo = nilOrString(env[8])
+		fetch.Envelope.MessageId = nilOrString(env[9])
+	case "FLAGS":
+		fetch.Flags = flagsFromSexp(value)
+	case "INTERNALDATE":
+		fetch.InternalDate = value.(string)
+		fetch.InternalTime, _ = ParseInternalDate(fetch.InternalDate)
+	case "RFC822":
+		fetch.Rfc822 = value.([]byte)
+	case "RFC822.HEADER":
+		fetch.Rfc822Header = value.([]byte)
+	case "UID":
+		fetch.UID, err = strconv.Atoi(value.(string))
+		check(err)
+	case "MODSEQ":
+		list := value.([]sexp)
+		if len(list) != 1 {
+			panic(fmt.Errorf("bad MODSEQ %#v", list))
+		}
+		fetch.ModSeq, err = strconv.ParseUint(list[0].(string), 10, 64)
+		check(err)
+	case "RFC822.SIZE":
+		fetch.Size, err = strconv.Atoi(value.(string))
+		check(err)
+	default:
+		sec, err := ParseFetchSection(key)
+		if err != nil {
+			panic(fmt.Errorf("unhandled fetch key %q", key))
+		}
+		if sec.Name == "BINARY.SIZE" {
+			size, err := strconv.Atoi(value.(string))
+			check(err)
+			if fetch.BinarySize == nil {
+				fetch.BinarySize = make(map[string]int)
+			}
+			fetch.BinarySize[sec.String()] = size
+			return
+		}
+		data := fetchBytes(value)
+		fetch.setBody(sec.String(), data)
+		if sec.Name == "BODY" && sec.Part == nil && sec.Origin < 0 {
+			switch sec.Specifier {
+			case "":
+				fetch.Rfc822 = data
+			case "HEADER":
+				fetch.Rfc822Header = data
+			}
+		}
+	}
+}
+
 // ResponseExists contains the message count of a mailbox.
 type ResponseExists struct {
 	Count int
@@ -416,8 +898,38 @@ func (r *reader) readUntagged() (resp interface{}, outErr error) {
 		return r.readCAPABILITY(), nil
 	case "LIST":
 		return r.readLIST(), nil
+	case "STATUS":
+		return r.readSTATUS(), nil
+	case "SEARCH":
+		return r.readSEARCH(), nil
+	case "ENABLED":
+		return &ResponseEnabled{r.readCAPABILITY().Capabilities}, nil
+	case "VANISHED":
+		return r.readVANISHED(), nil
+	case "ESEARCH":
+		return r.readESEARCH(), nil
+	case "NAMESPACE":
+		return r.readNAMESPACE(), nil
+	case "QUOTA":
+		return r.readQUOTA(), nil
+	case "QUOTAROOT":
+		return r.readQUOTAROOT(), nil
+	case "ACL":
+		return r.readACL(), nil
+	case "LISTRIGHTS":
+		return r.readLISTRIGHTS(), nil
+	case "MYRIGHTS":
+		return r.readMYRIGHTS(), nil
+	case "METADATA":
+		return r.readMETADATA(), nil
 	case "FLAGS":
 		return r.readFLAGS(), nil
+	case "BYE":
+		code, text := r.readRespText()
+		return &ResponseBye{code, text}, nil
+	case "PREAUTH":
+		code, text := r.readRespText()
+		return &ResponsePreauth{code, text}, nil
 	case "OK", "NO", "BAD":
 		resp, err := r.readStatus(command)
 		check(err)
@@ -38,7 +38,7 @@ func TestProtocol(t *testing.T) {
 		readerTest{
 			"* OK [PERMANENTFLAGS ()] Flags permitted.\r\n",
 			untagged,
-			&ResponsePermanentFlags{[]string{}},
+			&ResponsePermanentFlags{Flags{}},
 		},
 		readerTest{
 			"* OK [UIDVALIDITY 2] UIDs valid.\r\n",
@@ -0,0 +1,68 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+)
+
+// QResync is what a client remembers of a mailbox, for SelectQResync.
+type QResync struct {
+	UIDValidity int
+	ModSeq      uint64
+
+	// KnownUIDs, optional, is the set of UIDs the client knows of,
+	// as in "1:300,302"; it limits what the server reports.
+	KnownUIDs string
+
+	// SeqNums and UIDs, optional, pair some sequence numbers with
+	// the UIDs they had, so the server can tell which messages were
+	// expunged if it can't remember.  They need KnownUIDs.
+	SeqNums, UIDs string
+}
+
+// SelectQResync has the server report what changed in the mailbox
+// since q.ModSeq, provided q.UIDValidity is still valid: the messages
+// expunged and the messages changed, in ResponseExamine's Vanished and
+// Changed.  QRESYNC must have been enabled with EnableQResync.
+func SelectQResync(q QResync) SelectOption {
+	text := fmt.Sprintf("QRESYNC (%d %d", q.UIDValidity, q.ModSeq)
+	if q.KnownUIDs != "" {
+		text += " " + q.KnownUIDs
+		if q.SeqNums != "" && q.UIDs != "" {
+			text += " (" + q.SeqNums + " " + q.UIDs + ")"
+		}
+	}
+	return SelectOption(text + ")")
+}
+
+// QResync returns what is known of the selected mailbox for selecting
+// it again with SelectQResync, or false if the server doesn't keep
+// mod-sequences for it.
+func (m *MailboxState) QResync() (QResync, bool) {
+	s := m.Snapshot()
+	if s.Name == "" || s.UIDValidity == 0 || s.HighestModSeq == 0 {
+		return QResync{}, false
+	}
+	return QResync{UIDValidity: s.UIDValidity, ModSeq: s.HighestModSeq, KnownUIDs: m.knownUIDs()}, true
+}
+
+// EnableQResync turns on QRESYNC (RFC 7162) for the session, which
+// implies CONDSTORE.  The server then reports expunged messages with
+// VANISHED rather than EXPUNGE.  It must be called before selecting a
+// mailbox.
+func (imap *IMAP) EnableQResync() error {
+	return imap.EnableQResyncContext(context.Background())
+}
+
+func (imap *IMAP) EnableQResyncContext(ctx context.Context) error {
+	_, err := imap.EnableContext(ctx, "QRESYNC")
+	return err
+}
+
+func (imap *IMAP) EnableQResyncAsync() (*Command, error) {
+	return imap.EnableQResyncAsyncContext(context.Background())
+}
+
+func (imap *IMAP) EnableQResyncAsyncContext(ctx context.Context) (*Command, error) {
+	return imap.EnableAsyncContext(ctx, "QRESYNC")
+}
@@ -0,0 +1,263 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vanishedHandler struct {
+	NopHandler
+	events chan interface{}
+}
+
+func (h vanishedHandler) OnVanished(r *ResponseVanished) { h.events <- r }
+func (h vanishedHandler) OnFetch(r *ResponseFetch)       { h.events <- r }
+
+func TestSelectQResync(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	done := async(imap.EnableQResync)
+	srv.expect("a0 ENABLE QRESYNC")
+	srv.send("* ENABLED QRESYNC", "a0 OK enabled")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("EnableQResync: %s", err)
+	}
+
+	var examine *ResponseExamine
+	done = async(func() (err error) {
+		examine, err = imap.Select("INBOX", SelectQResync(QResync{
+			UIDValidity: 67890007,
+			ModSeq:      20050715194045000,
+			KnownUIDs:   "41,43:211,214:541",
+			SeqNums:     "1,3",
+			UIDs:        "41,43",
+		}))
+		return err
+	})
+	srv.expect(`a1 SELECT "INBOX" (QRESYNC (67890007 20050715194045000 41,43:211,214:541 (1,3 41,43)))`)
+	srv.send(
+		"* 314 EXISTS",
+		"* OK [UIDVALIDITY 67890007] UIDVALIDITY",
+		"* OK [HIGHESTMODSEQ 20050715194045007] Highest",
+		"* VANISHED (EARLIER) 41,43:116,118,120:211",
+		"* VANISHED (EARLIER) 214:540",
+		`* 49 FETCH (UID 117 FLAGS (\Seen \Answered) MODSEQ (90060115194045001))`,
+		"a1 OK [READ-WRITE] done",
+	)
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	if got, want := examine.Vanished, "41,43:116,118,120:211,214:540"; got != want {
+		t.Errorf("Vanished %q, want %q", got, want)
+	}
+	if len(examine.Changed) != 1 || examine.Changed[0].UID != 117 {
+		t.Errorf("Changed %#v", examine.Changed)
+	}
+	if s := imap.Mailbox().Snapshot(); s.Exists != 314 {
+		t.Errorf("Exists %d, want 314", s.Exists)
+	}
+}
+
+func TestMailboxVanished(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := vanishedHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	done := async(func() error {
+		_, err := imap.Select("INBOX")
+		return err
+	})
+	srv.expect(`a0 SELECT "INBOX"`)
+	srv.send("* 5 EXISTS", "* OK [UIDVALIDITY 9] ok", "* OK [HIGHESTMODSEQ 100] ok", "a0 OK [READ-WRITE] done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+
+	srv.send(
+		"* 1 FETCH (UID 10)",
+		"* 2 FETCH (UID 11)",
+		"* 3 FETCH (UID 12)",
+		"* 5 FETCH (UID 14)",
+		"* VANISHED 11:12",
+	)
+	for i := 0; i < 5; i++ {
+		select {
+		case <-h.events:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event")
+		}
+	}
+	if got, want := imap.Mailbox().UIDs(), []int{10, 0, 14}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UIDs() = %v, want %v", got, want)
+	}
+	if q, ok := imap.Mailbox().QResync(); !ok || q != (QResync{UIDValidity: 9, ModSeq: 100, KnownUIDs: "10,14"}) {
+		t.Errorf("QResync() = %+v, %v", q, ok)
+	}
+
+	// Losing a message whose UID we never saw makes the sequence
+	// numbers after the first unknown one uncertain.
+	srv.send("* VANISHED 13")
+	select {
+	case <-h.events:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+	if got, want := imap.Mailbox().UIDs(), []int{10, 0}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("UIDs() = %v, want %v", got, want)
+	}
+	if s := imap.Mailbox().Snapshot(); s.Exists != 2 {
+		t.Errorf("Exists %d, want 2", s.Exists)
+	}
+}
+
+func TestClientQResync(t *testing.T) {
+	f := &fakeServers{t: t}
+	f.reply = func(conn int, tag, cmd string) []string {
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN "):
+			return []string{tag + " OK [CAPABILITY IMAP4rev1 ENABLE QRESYNC] logged in"}
+		case cmd == "ENABLE QRESYNC":
+			return []string{"* ENABLED QRESYNC", tag + " OK enabled"}
+		case strings.HasPrefix(cmd, "SELECT ") && conn == 1:
+			return []string{"* 2 EXISTS", "* OK [UIDVALIDITY 7] ok", "* OK [HIGHESTMODSEQ 500] ok",
+				"* 1 FETCH (UID 4)", "* 2 FETCH (UID 5)", tag + " OK [READ-WRITE] done"}
+		case strings.HasPrefix(cmd, "SELECT "):
+			return []string{"* 1 EXISTS", "* OK [UIDVALIDITY 7] ok", "* OK [HIGHESTMODSEQ 510] ok",
+				"* VANISHED (EARLIER) 4", `* 1 FETCH (UID 5 FLAGS (\Seen) MODSEQ (505))`, tag + " OK [READ-WRITE] done"}
+		}
+		return nil
+	}
+	c := NewClient(alice)
+	c.Dial = f.dial
+	h := vanishedHandler{events: make(chan interface{}, 10)}
+	c.AddHandler(h)
+	ctx := context.Background()
+
+	err := c.Do(ctx, func(imap *IMAP) error {
+		_, err := imap.SelectContext(ctx, "INBOX")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	dropConn(t, c, f.srvs[0])
+	if err := c.Do(ctx, func(imap *IMAP) error { return nil }); err != nil {
+		t.Fatalf("Do: %s", err)
+	}
+
+	want := `1: LOGIN alice pw; 1: ENABLE QRESYNC; 1: SELECT "INBOX"; 2: LOGIN alice pw; 2: ENABLE QRESYNC; 2: SELECT "INBOX" (QRESYNC (7 500 4:5))`
+	if got := f.takeLog(); got != want {
+		t.Errorf("log %q\nwant %q", got, want)
+	}
+	got := []interface{}{<-h.events, <-h.events}
+	if v, ok := got[0].(*ResponseVanished); !ok || !v.Earlier || v.Set != "4" {
+		t.Errorf("got %#v, want VANISHED (EARLIER) 4", got[0])
+	}
+	if fetch, ok := got[1].(*ResponseFetch); !ok || fetch.UID != 5 || fetch.ModSeq != 505 {
+		t.Errorf("got %#v, want FETCH of UID 5", got[1])
+	}
+}
+
+func TestClientCondStoreResync(t *testing.T) {
+	f := &fakeServers{t: t}
+	f.reply = func(conn int, tag, cmd string) []string {
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN "):
+			return []string{tag + " OK [CAPABILITY IMAP4rev1 ENABLE CONDSTORE QRESYNC] logged in"}
+		case cmd == "ENABLE CONDSTORE":
+			return []string{"* ENABLED CONDSTORE", tag + " OK enabled"}
+		case strings.HasPrefix(cmd, "SELECT ") && conn == 1:
+			return []string{"* 3 EXISTS", "* OK [UIDVALIDITY 7] ok", "* OK [HIGHESTMODSEQ 500] ok",
+				"* 1 FETCH (UID 4)", "* 2 FETCH (UID 5)", "* 3 FETCH (UID 6)", tag + " OK [READ-WRITE] done"}
+		case strings.HasPrefix(cmd, "SELECT "):
+			return []string{"* 2 EXISTS", "* OK [UIDVALIDITY 7] ok", "* OK [HIGHESTMODSEQ 510] ok", tag + " OK [READ-WRITE] done"}
+		case strings.HasPrefix(cmd, "UID FETCH "):
+			return []string{`* 1 FETCH (UID 5 FLAGS (\Seen) MODSEQ (505))`, tag + " OK done"}
+		case strings.HasPrefix(cmd, "UID SEARCH "):
+			return []string{"* SEARCH 5 6", tag + " OK done"}
+		}
+		return nil
+	}
+	c := NewClient(alice)
+	c.Dial = f.dial
+	c.DisableQResync = true
+	h := vanishedHandler{events: make(chan interface{}, 10)}
+	c.AddHandler(h)
+	ctx := context.Background()
+
+	err := c.Do(ctx, func(imap *IMAP) error {
+		_, err := imap.SelectContext(ctx, "INBOX")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	dropConn(t, c, f.srvs[0])
+	if err := c.Do(ctx, func(imap *IMAP) error { return nil }); err != nil {
+		t.Fatalf("Do: %s", err)
+	}
+
+	want := `1: LOGIN alice pw; 1: ENABLE CONDSTORE; 1: SELECT "INBOX"; ` +
+		`2: LOGIN alice pw; 2: ENABLE CONDSTORE; 2: SELECT "INBOX" (CONDSTORE); ` +
+		`2: UID FETCH 1:* (UID FLAGS) (CHANGEDSINCE 500); 2: UID SEARCH UID 4:6`
+	if got := f.takeLog(); got != want {
+		t.Errorf("log %q\nwant %q", got, want)
+	}
+	got := []interface{}{<-h.events, <-h.events}
+	if fetch, ok := got[0].(*ResponseFetch); !ok || fetch.UID != 5 || fetch.ModSeq != 505 {
+		t.Errorf("got %#v, want FETCH of UID 5", got[0])
+	}
+	if v, ok := got[1].(*ResponseVanished); !ok || !v.Earlier || v.Set != "4" {
+		t.Errorf("got %#v, want VANISHED (EARLIER) 4", got[1])
+	}
+}
+
+func TestMailboxVanishedWide(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := vanishedHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h)
+
+	done := async(func() error {
+		_, err := imap.Select("INBOX")
+		return err
+	})
+	srv.expect(`a0 SELECT "INBOX"`)
+	srv.send("* 2 EXISTS", "a0 OK [READ-WRITE] done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+
+	// The whole UID space: matched by range, not listed out.
+	srv.send("* 1 FETCH (UID 7)", "* VANISHED 1:4294967295")
+	var vanished *ResponseVanished
+	for vanished == nil {
+		select {
+		case e := <-h.events:
+			vanished, _ = e.(*ResponseVanished)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no event")
+		}
+	}
+	if s := imap.Mailbox().Snapshot(); s.Exists != 0 || len(imap.Mailbox().UIDs()) != 0 {
+		t.Errorf("Exists %d, UIDs %v; want an empty mailbox", s.Exists, imap.Mailbox().UIDs())
+	}
+	if !vanished.Contains(4294967295) || vanished.Contains(0) {
+		t.Errorf("Contains is wrong for %q", vanished.Set)
+	}
+	if _, err := vanished.UIDs(); err == nil {
+		t.Errorf("UIDs of %q succeeded", vanished.Set)
+	}
+}
+
+func TestReadVanishedBad(t *testing.T) {
+	for _, input := range []string{"* VANISHED 1:*\r\n", "* VANISHED 3,x\r\n"} {
+		r := &reader{newParser(bytes.NewBufferString(input))}
+		if _, resp, err := r.readResponse(); err == nil {
+			t.Errorf("%q: got %#v, want an error", input, resp)
+		}
+	}
+}
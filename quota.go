@@ -0,0 +1,202 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Quota resources (RFC 9208).
+const (
+	// QuotaStorage is counted in units of 1024 octets.
+	QuotaStorage           = "STORAGE"
+	QuotaMessage           = "MESSAGE"
+	QuotaMailbox           = "MAILBOX"
+	QuotaAnnotationStorage = "ANNOTATION-STORAGE"
+)
+
+// QuotaResource is the usage and limit of a resource under a quota
+// root.  SetQuota only uses the Limit.
+type QuotaResource struct {
+	Name         string
+	Usage, Limit uint64
+}
+
+// ResponseQuota is a QUOTA response: the resources of a quota root.
+type ResponseQuota struct {
+	Root      string
+	Resources []QuotaResource
+}
+
+// Resource returns the named resource, or false if it isn't limited.
+func (r *ResponseQuota) Resource(name string) (QuotaResource, bool) {
+	for _, res := range r.Resources {
+		if strings.EqualFold(res.Name, name) {
+			return res, true
+		}
+	}
+	return QuotaResource{}, false
+}
+
+// ResponseQuotaRoot is a QUOTAROOT response: the quota roots a
+// mailbox counts against.
+type ResponseQuotaRoot struct {
+	Mailbox string
+	Roots   []string
+}
+
+// ErrOverQuota is matched, with errors.Is, by the *IMAPError of a
+// command that failed with [OVERQUOTA]: an APPEND, COPY or the like
+// that would have taken a quota root over its limit.
+var ErrOverQuota = errors.New("imap: over quota")
+
+func (r *reader) readQUOTA() *ResponseQuota {
+	// quota-root-name SP "(" quota-resource *(SP quota-resource) ")"
+	root, err := r.readAString()
+	check(err)
+	check(r.expect(" "))
+	list, err := r.readParenStringList()
+	check(err)
+	check(r.expectEOL())
+	if len(list)%3 != 0 {
+		panic(fmt.Errorf("bad QUOTA resources %q", list))
+	}
+	quota := &ResponseQuota{Root: root, Resources: []QuotaResource{}}
+	for i := 0; i < len(list); i += 3 {
+		usage, err := strconv.ParseUint(list[i+1], 10, 64)
+		check(err)
+		limit, err := strconv.ParseUint(list[i+2], 10, 64)
+		check(err)
+		quota.Resources = append(quota.Resources, QuotaResource{strings.ToUpper(list[i]), usage, limit})
+	}
+	return quota
+}
+
+func (r *reader) readQUOTAROOT() *ResponseQuotaRoot {
+	// mailbox *(SP quota-root-name)
+	mailbox, err := r.readAString()
+	check(err)
+	root := &ResponseQuotaRoot{Mailbox: mailbox, Roots: []string{}}
+	for {
+		c, err := r.ReadByte()
+		check(err)
+		if c != ' ' {
+			check(r.UnreadByte())
+			break
+		}
+		name, err := r.readAString()
+		check(err)
+		root.Roots = append(root.Roots, name)
+	}
+	check(r.expectEOL())
+	return root
+}
+
+// GetQuota returns the resources of a quota root.
+func (imap *IMAP) GetQuota(root string) (*ResponseQuota, error) {
+	return imap.GetQuotaContext(context.Background(), root)
+}
+
+func (imap *IMAP) GetQuotaContext(ctx context.Context, root string) (*ResponseQuota, error) {
+	c, err := imap.GetQuotaAsyncContext(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	_, quotas, err := imap.quotaResult(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, quota := range quotas {
+		if quota.Root == root {
+			return quota, nil
+		}
+	}
+	return nil, fmt.Errorf("imap: no QUOTA response for %q", root)
+}
+
+func (imap *IMAP) GetQuotaAsync(root string) (*Command, error) {
+	return imap.GetQuotaAsyncContext(context.Background(), root)
+}
+
+func (imap *IMAP) GetQuotaAsyncContext(ctx context.Context, root string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "GETQUOTA %s", quote(root))
+}
+
+// GetQuotaRoot returns the quota roots of a mailbox, with their
+// resources: how close a mailbox is to being full.
+func (imap *IMAP) GetQuotaRoot(mailbox string) (*ResponseQuotaRoot, []*ResponseQuota, error) {
+	return imap.GetQuotaRootContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) GetQuotaRootContext(ctx context.Context, mailbox string) (*ResponseQuotaRoot, []*ResponseQuota, error) {
+	c, err := imap.GetQuotaRootAsyncContext(ctx, mailbox)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots, quotas, err := imap.quotaResult(ctx, c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(roots) == 0 {
+		return nil, nil, fmt.Errorf("imap: no QUOTAROOT response for %q", mailbox)
+	}
+	return roots[0], quotas, nil
+}
+
+func (imap *IMAP) GetQuotaRootAsync(mailbox string) (*Command, error) {
+	return imap.GetQuotaRootAsyncContext(context.Background(), mailbox)
+}
+
+func (imap *IMAP) GetQuotaRootAsyncContext(ctx context.Context, mailbox string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "GETQUOTAROOT %s", quote(mailbox))
+}
+
+// SetQuota sets the limits of a quota root, which is usually for
+// administrators only.  Resources left out are no longer limited.
+func (imap *IMAP) SetQuota(root string, resources ...QuotaResource) error {
+	return imap.SetQuotaContext(context.Background(), root, resources...)
+}
+
+func (imap *IMAP) SetQuotaContext(ctx context.Context, root string, resources ...QuotaResource) error {
+	c, err := imap.SetQuotaAsyncContext(ctx, root, resources...)
+	if err != nil {
+		return err
+	}
+	_, _, err = imap.quotaResult(ctx, c)
+	return err
+}
+
+func (imap *IMAP) SetQuotaAsync(root string, resources ...QuotaResource) (*Command, error) {
+	return imap.SetQuotaAsyncContext(context.Background(), root, resources...)
+}
+
+func (imap *IMAP) SetQuotaAsyncContext(ctx context.Context, root string, resources ...QuotaResource) (*Command, error) {
+	limits := make([]string, len(resources))
+	for i, res := range resources {
+		limits[i] = fmt.Sprintf("%s %d", res.Name, res.Limit)
+	}
+	return imap.SendAsyncContext(ctx, "SETQUOTA %s (%s)", quote(root), strings.Join(limits, " "))
+}
+
+// quotaResult waits for a quota command and sorts out its responses.
+func (imap *IMAP) quotaResult(ctx context.Context, c *Command) ([]*ResponseQuotaRoot, []*ResponseQuota, error) {
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var roots []*ResponseQuotaRoot
+	quotas := make([]*ResponseQuota, 0)
+	for _, extra := range resp.Extra {
+		switch extra := extra.(type) {
+		case *ResponseQuotaRoot:
+			roots = append(roots, extra)
+		case *ResponseQuota:
+			quotas = append(quotas, extra)
+		default:
+			imap.unsolicited(extra)
+		}
+	}
+	return roots, quotas, nil
+}
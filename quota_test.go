@@ -0,0 +1,92 @@
+package imap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+
+	var root *ResponseQuotaRoot
+	var quotas []*ResponseQuota
+	done := async(func() (err error) {
+		root, quotas, err = imap.GetQuotaRoot("INBOX")
+		return err
+	})
+	srv.expect(`a0 GETQUOTAROOT "INBOX"`)
+	srv.send(`* QUOTAROOT INBOX "" "#user/joe"`, `* QUOTA "" (STORAGE 10 512 MESSAGE 3 100)`, `* QUOTA "#user/joe" (mailbox 2 10)`, "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetQuotaRoot: %s", err)
+	}
+	if want := (&ResponseQuotaRoot{Mailbox: "INBOX", Roots: []string{"", "#user/joe"}}); !reflect.DeepEqual(root, want) {
+		t.Errorf("got %#v, want %#v", root, want)
+	}
+	want := []*ResponseQuota{
+		{Root: "", Resources: []QuotaResource{{QuotaStorage, 10, 512}, {QuotaMessage, 3, 100}}},
+		{Root: "#user/joe", Resources: []QuotaResource{{QuotaMailbox, 2, 10}}},
+	}
+	if !reflect.DeepEqual(quotas, want) {
+		t.Errorf("got %#v, want %#v", quotas, want)
+	}
+	if res, ok := quotas[0].Resource("storage"); !ok || res.Limit != 512 {
+		t.Errorf("Resource(storage) = %v, %v", res, ok)
+	}
+
+	var quota *ResponseQuota
+	done = async(func() (err error) {
+		quota, err = imap.GetQuota("")
+		return err
+	})
+	srv.expect(`a1 GETQUOTA ""`)
+	srv.send(`* QUOTA "" (STORAGE 10 512)`, "a1 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("GetQuota: %s", err)
+	}
+	if quota.Root != "" || len(quota.Resources) != 1 {
+		t.Errorf("got %#v", quota)
+	}
+
+	done = async(func() error {
+		return imap.SetQuota("", QuotaResource{Name: QuotaStorage, Limit: 1024}, QuotaResource{Name: QuotaMessage, Limit: 500})
+	})
+	srv.expect(`a2 SETQUOTA "" (STORAGE 1024 MESSAGE 500)`)
+	srv.send("a2 NO [NOPERM] not an administrator")
+	var imapErr *IMAPError
+	if err := wait(t, done); !errors.As(err, &imapErr) || imapErr.Status != NO {
+		t.Errorf("SetQuota: got %v, want NO", err)
+	}
+}
+
+func TestOverQuota(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error {
+		_, err := imap.SendSync("COPY 1:3 Archive")
+		return err
+	})
+	srv.expect("a0 COPY 1:3 Archive")
+	srv.send("a0 NO [OVERQUOTA] Disk quota exceeded")
+	err := wait(t, done)
+	if !errors.Is(err, ErrOverQuota) {
+		t.Fatalf("got %#v, want ErrOverQuota", err)
+	}
+	// It's still an *IMAPError, as callers have always checked.
+	if imapErr, ok := err.(*IMAPError); !ok || imapErr.Status != NO || imapErr.Code != "OVERQUOTA" || imapErr.Text != "Disk quota exceeded" {
+		t.Errorf("got %#v, want the IMAPError", err)
+	}
+	var imapErr *IMAPError
+	if !errors.As(err, &imapErr) {
+		t.Errorf("errors.As doesn't find the IMAPError")
+	}
+
+	done = async(func() error {
+		_, err := imap.SendSync("COPY 1:3 Archive")
+		return err
+	})
+	srv.expect("a1 COPY 1:3 Archive")
+	srv.send("a1 NO [TRYCREATE] no such mailbox")
+	if err := wait(t, done); errors.Is(err, ErrOverQuota) {
+		t.Errorf("got ErrOverQuota for %v", err)
+	}
+}
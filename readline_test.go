@@ -0,0 +1,64 @@
+package imap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadLongLine(t *testing.T) {
+	text := strings.Repeat("x", 10000)
+	r := &reader{newParser(bytes.NewBufferString("* OK " + text + "\r\n"))}
+	_, resp, err := r.readResponse()
+	if err != nil {
+		t.Fatalf("readResponse: %s", err)
+	}
+	if status := resp.(*ResponseStatus); status.Text != text {
+		t.Fatalf("got %d bytes of text, want %d", len(status.Text), len(text))
+	}
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	tests := []string{
+		"* OK " + strings.Repeat("x", 5000) + "\r\n",
+		"* CAPABILITY IMAP4rev1 " + strings.Repeat("X", 5000) + "\r\n",
+	}
+	for _, input := range tests {
+		r := &reader{newParser(bytes.NewBufferString(input))}
+		r.maxLine = 4096
+		_, _, err := r.readResponse()
+		if e, ok := err.(*LineTooLongError); !ok || e.Limit != 4096 {
+			t.Errorf("readResponse(%.20q...) error = %v, want LineTooLongError", input, err)
+		}
+	}
+}
+
+func TestReadLineTooLongTokens(t *testing.T) {
+	// Each token is short, but the line is over the limit.
+	nums := strings.Repeat(" 12345", 400000)
+	r := &reader{newParser(bytes.NewBufferString("* SEARCH" + nums + "\r\n"))}
+	_, _, err := r.readResponse()
+	if e, ok := err.(*LineTooLongError); !ok || e.Limit != DefaultMaxLineLength {
+		t.Errorf("readResponse error = %v, want LineTooLongError", err)
+	}
+
+	// Literals don't count against the line, but against their own
+	// limit.
+	literal := strings.Repeat("x", 5000)
+	r = &reader{newParser(bytes.NewBufferString("* 1 FETCH (RFC822 {5000}\r\n" + literal + ")\r\n* 2 EXISTS\r\n"))}
+	r.maxLine = 4096
+	if _, resp, err := r.readResponse(); err != nil || len(resp.(*ResponseFetch).Rfc822) != 5000 {
+		t.Fatalf("readResponse with a literal: %v", err)
+	}
+	// The count starts over with each response.
+	if _, _, err := r.readResponse(); err != nil {
+		t.Errorf("readResponse after a long one: %v", err)
+	}
+
+	r = &reader{newParser(bytes.NewBufferString("* 1 FETCH (RFC822 {5000}\r\n" + literal + ")\r\n"))}
+	r.maxLiteral = 4096
+	_, _, err = r.readResponse()
+	if e, ok := err.(*LiteralTooLongError); !ok || e.Length != 5000 || e.Limit != 4096 {
+		t.Errorf("readResponse error = %v, want LiteralTooLongError", err)
+	}
+}
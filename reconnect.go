@@ -0,0 +1,365 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults for Client's reconnection backoff.
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+// maxRetries bounds how often Do repeats a function whose connection
+// broke, in case it is what breaks it.
+const maxRetries = 3
+
+// UIDValidityError is returned when, on reconnecting, the mailbox
+// that was selected turns out to have a new UIDVALIDITY: the UIDs
+// known from before refer to other messages now, or to none.
+type UIDValidityError struct {
+	Mailbox  string
+	Old, New int
+}
+
+func (e *UIDValidityError) Error() string {
+	return fmt.Sprintf("imap: UIDVALIDITY of %q changed from %d to %d", e.Mailbox, e.Old, e.New)
+}
+
+// Client is a connection that survives losing its network connection,
+// as when a laptop sleeps.  When the connection is found broken, the
+// next use redials with backoff, logs in again and re-selects the
+// mailbox that was selected, checking its UIDVALIDITY.  Until the
+// mailbox is selected again, each use tries to, and fails with why it
+// couldn't; see ForgetMailbox.
+//
+// Commands are issued through Do, which retries them on a new
+// connection if the old one broke, or DoOnce for commands that
+// mustn't be repeated.
+type Client struct {
+	Account Account
+
+	// Dial, TLSConfig and Setup are as for Pool.
+	Dial      func(ctx context.Context, server string) (*IMAP, error)
+	TLSConfig *tls.Config
+	Setup     func(*IMAP)
+
+	// MinBackoff and MaxBackoff bound the wait between attempts to
+	// reconnect, which doubles after each failure; zero means
+	// DefaultMinBackoff and DefaultMaxBackoff.
+	MinBackoff, MaxBackoff time.Duration
+
+	// Each connection enables QRESYNC, if the server supports it,
+	// so that on reconnecting the server reports just what changed
+	// in the mailbox meanwhile: VANISHED (EARLIER) for the messages
+	// expunged and FETCH for the ones changed, which go to the
+	// handlers.  Failing that, or with DisableQResync set, it enables
+	// CONDSTORE, and the client asks for the same with a UID FETCH of
+	// the messages changed and a UID SEARCH of those still there.
+	DisableQResync bool
+
+	// sem is held while connecting; it guards imap, lost and closed.
+	sem    chan struct{}
+	imap   *IMAP
+	closed bool
+
+	// lost is the mailbox to select again on imap before it is
+	// handed out, or nil.
+	lost *lostMailbox
+
+	handlers handlers
+}
+
+// NewClient returns a client for account.  It connects on first use.
+func NewClient(account Account) *Client {
+	return &Client{Account: account, sem: make(chan struct{}, 1)}
+}
+
+// AddHandler registers a handler for unsolicited data on this and
+// every later connection; see IMAP.AddHandler.
+func (c *Client) AddHandler(h Handler) (remove func()) {
+	return c.handlers.add(h)
+}
+
+// Queue returns the default QueueHandler of this and every later
+// connection; see IMAP.Queue.
+func (c *Client) Queue() *QueueHandler {
+	return c.handlers.defaultQueue()
+}
+
+// forwardHandler passes data from a connection on to its Client's
+// handlers.
+type forwardHandler struct {
+	NopHandler
+	hs *handlers
+}
+
+func (f forwardHandler) handle(r interface{}) {
+	f.hs.handle(r)
+}
+
+// Conn returns a working connection, reconnecting if need be.  The
+// connection may yet break; Do deals with that.
+func (c *Client) Conn(ctx context.Context) (*IMAP, error) {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.sem }()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+	if c.imap != nil && c.imap.Err() == nil {
+		return c.resumeLost(ctx)
+	}
+	return c.reconnect(ctx)
+}
+
+// ForgetMailbox stops the client selecting again the mailbox that was
+// selected before the connection broke, as it otherwise tries to on
+// each use until it succeeds: when the mailbox has been deleted
+// meanwhile, say.
+func (c *Client) ForgetMailbox() {
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+	c.lost = nil
+}
+
+// lostMailbox is what is known of the mailbox a broken connection had
+// selected.
+type lostMailbox struct {
+	status MailboxStatus
+	uids   []int
+}
+
+// reconnect replaces a broken connection, or makes the first, and
+// selects the mailbox again as resumeLost does.  Called with sem held.
+func (c *Client) reconnect(ctx context.Context) (*IMAP, error) {
+	if c.imap != nil {
+		c.imap.Close()
+		if c.lost == nil {
+			mailbox := c.imap.Mailbox()
+			if s := mailbox.Snapshot(); s.Name != "" {
+				c.lost = &lostMailbox{s, mailbox.UIDs()}
+			}
+		}
+		c.imap = nil
+	}
+
+	backoff := c.MinBackoff
+	if backoff <= 0 {
+		backoff = DefaultMinBackoff
+	}
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	for {
+		imap, err := c.Account.connect(ctx, dialFunc(c.Dial, c.TLSConfig, c.Setup))
+		if err == nil {
+			imap.AddHandler(forwardHandler{hs: &c.handlers})
+			c.imap = imap
+			if err := c.enableResync(ctx, imap); err != nil {
+				return nil, err
+			}
+			return c.resumeLost(ctx)
+		}
+		var imapErr *IMAPError
+		if errors.As(err, &imapErr) {
+			// Login refused; trying again won't help.
+			return nil, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// enableResync enables QRESYNC on imap, unless DisableQResync is set,
+// or else CONDSTORE, if the server supports either.
+func (c *Client) enableResync(ctx context.Context, imap *IMAP) error {
+	ok, err := imap.supports(ctx, "ENABLE")
+	if err != nil || !ok {
+		return err
+	}
+	switch {
+	case !c.DisableQResync && imap.Has("QRESYNC"):
+		return imap.EnableQResyncContext(ctx)
+	case imap.Has("CONDSTORE"):
+		return imap.EnableCondStoreContext(ctx)
+	}
+	return nil
+}
+
+// resumeLost returns c.imap once the mailbox the broken connection
+// had selected, if any, is selected again on it.  If that fails, it
+// returns the error, and the next use tries again.  A
+// *UIDValidityError is returned just the once, with the connection:
+// the mailbox is selected, only the UIDs known are void.  Called with
+// sem held.
+func (c *Client) resumeLost(ctx context.Context) (*IMAP, error) {
+	if c.lost == nil {
+		return c.imap, nil
+	}
+	err := c.resume(ctx, c.imap, c.lost)
+	var validityErr *UIDValidityError
+	switch {
+	case err == nil:
+		c.lost = nil
+		return c.imap, nil
+	case errors.As(err, &validityErr):
+		c.lost = nil
+		return c.imap, err
+	}
+	return nil, err
+}
+
+// resume re-selects the mailbox a broken connection had selected,
+// with QRESYNC if it is enabled, or else CONDSTORE, and passes on to
+// the handlers what changed meanwhile.
+func (c *Client) resume(ctx context.Context, imap *IMAP, old *lostMailbox) error {
+	q := QResync{UIDValidity: old.status.UIDValidity, ModSeq: old.status.HighestModSeq, KnownUIDs: formatUIDSet(old.uids)}
+	condStore := false
+	var opts []SelectOption
+	if q.UIDValidity != 0 && q.ModSeq != 0 {
+		switch {
+		case imap.Enabled("QRESYNC"):
+			opts = append(opts, SelectQResync(q))
+		case imap.Has("CONDSTORE"):
+			opts = append(opts, SelectCondStore)
+			condStore = true
+		}
+	}
+	var r *ResponseExamine
+	var err error
+	if old.status.ReadOnly {
+		r, err = imap.ExamineContext(ctx, old.status.Name, opts...)
+	} else {
+		r, err = imap.SelectContext(ctx, old.status.Name, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	now := imap.Mailbox().Snapshot()
+	if old.status.UIDValidity != 0 && now.UIDValidity != old.status.UIDValidity {
+		return &UIDValidityError{old.status.Name, old.status.UIDValidity, now.UIDValidity}
+	}
+	if r.Vanished != "" {
+		imap.unsolicited(&ResponseVanished{Earlier: true, Set: r.Vanished})
+	}
+	for _, fetch := range r.Changed {
+		imap.unsolicited(fetch)
+	}
+	if condStore {
+		return condStoreResync(ctx, imap, q.ModSeq, old.uids)
+	}
+	return nil
+}
+
+// condStoreResync finds out what QRESYNC would have reported on
+// selecting the mailbox again: a FETCH of each message changed since
+// modseq, and a VANISHED (EARLIER) of those of uids expunged.
+func condStoreResync(ctx context.Context, imap *IMAP, modseq uint64, uids []int) error {
+	fetch := formatFetch("1:*", []string{"UID", "FLAGS"}, []FetchModifier{ChangedSince(modseq)})
+	c, err := imap.SendAsyncContext(ctx, "UID %s", fetch)
+	if err != nil {
+		return err
+	}
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return err
+	}
+	for _, extra := range resp.Extra {
+		imap.unsolicited(extra)
+	}
+
+	known := formatUIDSet(uids)
+	if known == "" {
+		return nil
+	}
+	search, err := imap.UIDSearchContext(ctx, "UID "+known)
+	if err != nil {
+		return err
+	}
+	kept := make(map[int]bool, len(search.IDs))
+	for _, uid := range search.IDs {
+		kept[uid] = true
+	}
+	var gone []int
+	for _, uid := range uids {
+		if uid != 0 && !kept[uid] {
+			gone = append(gone, uid)
+		}
+	}
+	if len(gone) > 0 {
+		imap.unsolicited(&ResponseVanished{Earlier: true, Set: formatUIDSet(gone)})
+	}
+	return nil
+}
+
+// Do calls f with a working connection.  If the connection breaks
+// before f returns, Do reconnects and calls f again, so f must be safe
+// to repeat: FETCH, SEARCH, STORE of flags and the like.  It gives up
+// after a few attempts, or with an error from reconnecting, including
+// a *UIDValidityError, in which case f isn't repeated.
+func (c *Client) Do(ctx context.Context, f func(*IMAP) error) error {
+	var err error
+	for i := 0; i <= maxRetries; i++ {
+		var imap *IMAP
+		imap, err = c.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		err = f(imap)
+		if err == nil || !broken(imap) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// DoOnce calls f with a working connection, once.  If the connection
+// breaks meanwhile, f's command may or may not have taken effect; the
+// error is returned and the next use reconnects.  Use it for APPEND,
+// COPY, EXPUNGE and other commands that mustn't be repeated.
+func (c *Client) DoOnce(ctx context.Context, f func(*IMAP) error) error {
+	imap, err := c.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	return f(imap)
+}
+
+// broken reports whether a connection failed, rather than being
+// closed or logged out.
+func broken(imap *IMAP) bool {
+	err := imap.Err()
+	return err != nil && err != ErrClosed && err != ErrLoggedOut
+}
+
+// Close logs out and stops the client reconnecting.
+func (c *Client) Close() error {
+	c.sem <- struct{}{}
+	defer func() { <-c.sem }()
+	c.closed = true
+	if c.imap == nil || c.imap.Err() != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := c.imap.LogoutContext(ctx)
+	c.imap.Close()
+	return err
+}
@@ -0,0 +1,182 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dropConn breaks the client's connection to srv and waits until the
+// client has noticed.
+func dropConn(t *testing.T, c *Client, srv *testServer) {
+	t.Helper()
+	imap, err := c.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	srv.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for imap.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("connection still up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	f := &fakeServers{t: t}
+	f.reply = func(conn int, tag, cmd string) []string {
+		switch {
+		case strings.HasPrefix(cmd, "SELECT "):
+			return []string{"* 3 EXISTS", "* OK [UIDVALIDITY 7] ok", tag + " OK [READ-WRITE] done"}
+		case strings.HasPrefix(cmd, "FETCH ") && conn == 2:
+			// The network goes away mid-command.
+			f.srvs[conn-1].conn.Close()
+			return []string{}
+		}
+		return nil
+	}
+	dials := 0
+	c := NewClient(alice)
+	c.MinBackoff = time.Millisecond
+	c.Dial = func(ctx context.Context, server string) (*IMAP, error) {
+		if dials++; dials == 2 {
+			return nil, errors.New("network unreachable")
+		}
+		return f.dial(ctx, server)
+	}
+	ctx := context.Background()
+
+	err := c.Do(ctx, func(imap *IMAP) error {
+		_, err := imap.SelectContext(ctx, "INBOX")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	f.takeLog()
+
+	// The laptop sleeps.
+	dropConn(t, c, f.srvs[0])
+	fetches := 0
+	err = c.Do(ctx, func(imap *IMAP) error {
+		fetches++
+		_, err := imap.FetchContext(ctx, "1", []string{"FLAGS"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	if fetches != 2 {
+		t.Errorf("fetched %d times, want 2", fetches)
+	}
+	want := `2: LOGIN alice pw; 2: CAPABILITY; 2: SELECT "INBOX"; 2: FETCH 1 FLAGS; 3: LOGIN alice pw; 3: CAPABILITY; 3: SELECT "INBOX"; 3: FETCH 1 FLAGS`
+	if got := f.takeLog(); got != want {
+		t.Errorf("log %q\nwant %q", got, want)
+	}
+}
+
+func TestClientUIDValidityChanged(t *testing.T) {
+	f := &fakeServers{t: t}
+	f.reply = func(conn int, tag, cmd string) []string {
+		if strings.HasPrefix(cmd, "EXAMINE ") {
+			return []string{"* OK [UIDVALIDITY " + string(rune('0'+conn)) + "] ok", tag + " OK [READ-ONLY] done"}
+		}
+		return nil
+	}
+	c := NewClient(alice)
+	c.Dial = f.dial
+	ctx := context.Background()
+
+	err := c.Do(ctx, func(imap *IMAP) error {
+		_, err := imap.ExamineContext(ctx, "Archive")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Examine: %s", err)
+	}
+	dropConn(t, c, f.srvs[0])
+
+	called := false
+	err = c.Do(ctx, func(imap *IMAP) error {
+		called = true
+		return nil
+	})
+	want := &UIDValidityError{Mailbox: "Archive", Old: 1, New: 2}
+	if e, ok := err.(*UIDValidityError); !ok || *e != *want {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	if called {
+		t.Errorf("function called despite the UIDVALIDITY change")
+	}
+	if got, want := f.takeLog(), `1: LOGIN alice pw; 1: CAPABILITY; 1: EXAMINE "Archive"; 2: LOGIN alice pw; 2: CAPABILITY; 2: EXAMINE "Archive"`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+
+	// The client carries on with the new connection.
+	if err := c.Do(ctx, func(imap *IMAP) error { return imap.NoopContext(ctx) }); err != nil {
+		t.Fatalf("Noop: %s", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	if err := c.Do(ctx, func(*IMAP) error { return nil }); err != ErrClosed {
+		t.Fatalf("Do after Close: got %v, want ErrClosed", err)
+	}
+}
+
+func TestClientResumeFails(t *testing.T) {
+	f := &fakeServers{t: t}
+	deleted := false
+	f.reply = func(conn int, tag, cmd string) []string {
+		f.mu.Lock()
+		gone := deleted
+		f.mu.Unlock()
+		if strings.HasPrefix(cmd, "SELECT ") && gone {
+			return []string{tag + " NO no such mailbox"}
+		}
+		return nil
+	}
+	c := NewClient(alice)
+	c.Dial = f.dial
+	ctx := context.Background()
+
+	err := c.Do(ctx, func(imap *IMAP) error {
+		_, err := imap.SelectContext(ctx, "Lists")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Select: %s", err)
+	}
+	f.mu.Lock()
+	deleted = true
+	f.mu.Unlock()
+	dropConn(t, c, f.srvs[0])
+	f.takeLog()
+
+	// The failure is reported on every use, not just the first.
+	for i := 0; i < 2; i++ {
+		var imapErr *IMAPError
+		if _, err := c.Conn(ctx); !errors.As(err, &imapErr) {
+			t.Fatalf("Conn: got %v, want the SELECT's NO", err)
+		}
+	}
+	if got, want := f.takeLog(), `2: LOGIN alice pw; 2: CAPABILITY; 2: SELECT "Lists"; 2: SELECT "Lists"`; got != want {
+		t.Errorf("log %q, want %q", got, want)
+	}
+
+	c.ForgetMailbox()
+	imap, err := c.Conn(ctx)
+	if err != nil {
+		t.Fatalf("Conn after ForgetMailbox: %s", err)
+	}
+	if s := imap.Mailbox().Snapshot(); s.Name != "" {
+		t.Errorf("mailbox %q selected", s.Name)
+	}
+	if got := f.takeLog(); got != "" {
+		t.Errorf("log %q, want nothing", got)
+	}
+}
@@ -0,0 +1,74 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ProtocolVersion is the version of the protocol a connection speaks.
+type ProtocolVersion string
+
+const (
+	IMAP4rev1 ProtocolVersion = "IMAP4rev1"
+	// IMAP4rev2 (RFC 9051) drops RECENT and the \Recent flag,
+	// answers SEARCH with ESEARCH, and folds many extensions into
+	// the base protocol; see rev2Implied.
+	IMAP4rev2 ProtocolVersion = "IMAP4rev2"
+)
+
+// rev2Implied are the extensions a server offering IMAP4rev2 has,
+// whether it lists them or not.
+var rev2Implied = []string{
+	"NAMESPACE", "UNSELECT", "UIDPLUS", "ESEARCH", "SEARCHRES",
+	"ENABLE", "IDLE", "SASL-IR", "LIST-EXTENDED", "LIST-STATUS",
+	"MOVE", "LITERAL-", "BINARY", "SPECIAL-USE", "STATUS=SIZE",
+	"CHILDREN",
+}
+
+// Version returns the protocol version in effect: IMAP4rev2 once it
+// has been enabled, which happens on logging in if the server offers
+// it, unless DisableRev2 is set.
+func (imap *IMAP) Version() ProtocolVersion {
+	if imap.Enabled(string(IMAP4rev2)) {
+		return IMAP4rev2
+	}
+	return IMAP4rev1
+}
+
+// upgrade enables IMAP4rev2 if the server offers it, asking for the
+// capabilities if the login didn't say.  Called once authenticated.
+// A server that refuses leaves the connection on IMAP4rev1, which is
+// no reason to fail the login; only a broken connection is an error.
+func (imap *IMAP) upgrade(ctx context.Context) error {
+	if imap.DisableRev2 {
+		return nil
+	}
+	rev2, err := imap.supports(ctx, string(IMAP4rev2))
+	if err == nil && rev2 {
+		_, err = imap.EnableContext(ctx, string(IMAP4rev2))
+	}
+	var imapErr *IMAPError
+	if errors.As(err, &imapErr) {
+		return nil
+	}
+	return err
+}
+
+// rev2FetchItems replaces the RFC822 items, which IMAP4rev2 drops, by
+// their BODY equivalents.  The responses are mapped back by readFETCH.
+func rev2FetchItems(fields []string) []string {
+	mapped := make([]string, len(fields))
+	for i, field := range fields {
+		switch strings.ToUpper(field) {
+		case "RFC822":
+			field = "BODY[]"
+		case "RFC822.HEADER":
+			field = "BODY.PEEK[HEADER]"
+		case "RFC822.TEXT":
+			field = "BODY[TEXT]"
+		}
+		mapped[i] = field
+	}
+	return mapped
+}
@@ -0,0 +1,191 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// loginRev2 logs in to a server offering IMAP4rev2.
+func loginRev2(t *testing.T, imap *IMAP, srv *testServer) {
+	t.Helper()
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	srv.expect("a0 LOGIN joe secret")
+	srv.send("a0 OK [CAPABILITY IMAP4rev1 IMAP4rev2 AUTH=PLAIN] Logged in")
+	srv.expect("a1 ENABLE IMAP4rev2")
+	srv.send("* ENABLED IMAP4rev2", "a1 OK enabled")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+}
+
+func TestRev2(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 IMAP4rev2 STARTTLS] ready")
+	if v := imap.Version(); v != IMAP4rev1 {
+		t.Errorf("Version() = %s before login", v)
+	}
+	loginRev2(t, imap, srv)
+	if v := imap.Version(); v != IMAP4rev2 {
+		t.Errorf("Version() = %s, want IMAP4rev2", v)
+	}
+	if !imap.Has("MOVE") || !imap.Has("namespace") || imap.Has("QRESYNC") {
+		t.Errorf("Has: wrong for %v", imap.Capabilities())
+	}
+
+	var search *ResponseSearch
+	done := async(func() (err error) {
+		search, err = imap.UIDSearch("UNSEEN")
+		return err
+	})
+	srv.expect("a2 UID SEARCH UNSEEN")
+	srv.send(`* ESEARCH (TAG "a2") UID ALL 4:6,9`, "a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("UIDSearch: %s", err)
+	}
+	if want := []int{4, 5, 6, 9}; !reflect.DeepEqual(search.IDs, want) {
+		t.Errorf("IDs %v, want %v", search.IDs, want)
+	}
+
+	done = async(func() (err error) {
+		search, err = imap.Search("DELETED")
+		return err
+	})
+	srv.expect("a3 SEARCH DELETED")
+	srv.send(`* ESEARCH (TAG "a3")`, "a3 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Search: %s", err)
+	}
+	if len(search.IDs) != 0 {
+		t.Errorf("IDs %v, want none", search.IDs)
+	}
+
+	// RFC822 items become their BODY equivalents.
+	var fetched []*ResponseFetch
+	done = async(func() (err error) {
+		fetched, err = imap.Fetch("1", []string{"RFC822", "RFC822.SIZE", "BINARY.SIZE[1]"})
+		return err
+	})
+	srv.expect("a4 FETCH 1 (BODY[] RFC822.SIZE BINARY.SIZE[1])")
+	srv.send("* 1 FETCH (BODY[] {5}", "hello RFC822.SIZE 5 BINARY.SIZE[1] 3)", "a4 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Fetch: %s", err)
+	}
+	if len(fetched) != 1 || string(fetched[0].Rfc822) != "hello" || fetched[0].BinarySize["BINARY.SIZE[1]"] != 3 {
+		t.Errorf("fetched %#v", fetched)
+	}
+}
+
+func TestDisableRev2(t *testing.T) {
+	imap, srv := newTestConn(t)
+	imap.DisableRev2 = true
+	go srv.send("* OK ready")
+	if _, err := imap.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	srv.expect("a0 LOGIN joe secret")
+	srv.send("a0 OK [CAPABILITY IMAP4rev1 IMAP4rev2] Logged in")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+	if v := imap.Version(); v != IMAP4rev1 {
+		t.Errorf("Version() = %s, want IMAP4rev1", v)
+	}
+}
+
+func TestReadESEARCH(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	var resp *ResponseStatus
+	done := async(func() (err error) {
+		resp, err = imap.SendSync("NOOP")
+		return err
+	})
+	srv.expect("a0 NOOP")
+	srv.send(`* ESEARCH (TAG "x1") UID MIN 2 MAX 40 COUNT 7 PARTIAL (1:10 2:4) MODSEQ 917`, `* 1 FETCH (BINARY[1] ~{3}`, "abc)", "a0 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("NOOP: %s", err)
+	}
+	if len(resp.Extra) != 2 {
+		t.Fatalf("got %#v", resp.Extra)
+	}
+	want := &ResponseESearch{Tag: "x1", UID: true, Min: 2, Max: 40, Count: 7, ModSeq: 917}
+	if !reflect.DeepEqual(resp.Extra[0], want) {
+		t.Errorf("got %#v, want %#v", resp.Extra[0], want)
+	}
+	if fetch, ok := resp.Extra[1].(*ResponseFetch); !ok || string(fetch.Body["BINARY[1]"]) != "abc" {
+		t.Errorf("got %#v", resp.Extra[1])
+	}
+}
+
+func TestESearchWide(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error {
+		_, err := imap.UIDSearch("ALL")
+		return err
+	})
+	srv.expect("a0 UID SEARCH ALL")
+	srv.send(`* ESEARCH (TAG "a0") UID ALL 1:4294967295`, "a0 OK done")
+	if err := wait(t, done); err == nil {
+		t.Errorf("UIDSearch listed 4294967295 UIDs")
+	}
+
+	wide := &ResponseESearch{All: "3,10:4294967295"}
+	if !wide.Contains(4294967295) || wide.Contains(4) {
+		t.Errorf("Contains is wrong for %q", wide.All)
+	}
+
+	r := &reader{newParser(bytes.NewBufferString("* ESEARCH ALL 2:*\r\n"))}
+	if _, resp, err := r.readResponse(); err == nil {
+		t.Errorf("got %#v, want an error", resp)
+	}
+}
+
+func TestRev2AfterPlainLogin(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK [CAPABILITY IMAP4rev1 IMAP4rev2] ready")
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	// The login doesn't say what the server offers now, so ask.
+	srv.expect("a0 LOGIN joe secret")
+	srv.send("a0 OK logged in")
+	srv.expect("a1 CAPABILITY")
+	srv.send("* CAPABILITY IMAP4rev1 IMAP4rev2", "a1 OK done")
+	srv.expect("a2 ENABLE IMAP4rev2")
+	srv.send("* ENABLED IMAP4rev2", "a2 OK enabled")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+	if v := imap.Version(); v != IMAP4rev2 {
+		t.Errorf("Version() = %s, want IMAP4rev2", v)
+	}
+}
+
+func TestRev2Refused(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	done := async(func() error {
+		_, _, err := imap.Auth("joe", "secret")
+		return err
+	})
+	// A refused ENABLE leaves the session on IMAP4rev1; the login
+	// itself went fine.
+	srv.expect("a0 LOGIN joe secret")
+	srv.send("a0 OK [CAPABILITY IMAP4rev1 IMAP4rev2] logged in")
+	srv.expect("a1 ENABLE IMAP4rev2")
+	srv.send("a1 NO not today")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Auth: %s", err)
+	}
+	if v := imap.Version(); v != IMAP4rev1 {
+		t.Errorf("Version() = %s, want IMAP4rev1", v)
+	}
+	if s := imap.State(); s != StateAuthenticated {
+		t.Errorf("State() = %v, want authenticated", s)
+	}
+}
@@ -0,0 +1,78 @@
+package imap
+
+import "context"
+
+// Search returns the sequence numbers of the messages matching
+// criteria, given in the protocol's syntax (RFC 3501 section 6.4.4),
+// as in "UNSEEN SINCE 1-Feb-1994" or, with CONDSTORE, "MODSEQ 620162338".
+func (imap *IMAP) Search(criteria string) (*ResponseSearch, error) {
+	return imap.SearchContext(context.Background(), criteria)
+}
+
+func (imap *IMAP) SearchContext(ctx context.Context, criteria string) (*ResponseSearch, error) {
+	c, err := imap.SearchAsyncContext(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return imap.searchResult(ctx, c)
+}
+
+func (imap *IMAP) SearchAsync(criteria string) (*Command, error) {
+	return imap.SearchAsyncContext(context.Background(), criteria)
+}
+
+func (imap *IMAP) SearchAsyncContext(ctx context.Context, criteria string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "SEARCH %s", criteria)
+}
+
+// UIDSearch is Search returning UIDs.
+func (imap *IMAP) UIDSearch(criteria string) (*ResponseSearch, error) {
+	return imap.UIDSearchContext(context.Background(), criteria)
+}
+
+func (imap *IMAP) UIDSearchContext(ctx context.Context, criteria string) (*ResponseSearch, error) {
+	c, err := imap.UIDSearchAsyncContext(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return imap.searchResult(ctx, c)
+}
+
+func (imap *IMAP) UIDSearchAsync(criteria string) (*Command, error) {
+	return imap.UIDSearchAsyncContext(context.Background(), criteria)
+}
+
+func (imap *IMAP) UIDSearchAsyncContext(ctx context.Context, criteria string) (*Command, error) {
+	return imap.SendAsyncContext(ctx, "UID SEARCH %s", criteria)
+}
+
+// searchResult merges the SEARCH responses to c, of which servers may
+// send several.
+func (imap *IMAP) searchResult(ctx context.Context, c *Command) (*ResponseSearch, error) {
+	resp, err := c.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &ResponseSearch{IDs: []int{}}
+	for _, extra := range resp.Extra {
+		switch search := extra.(type) {
+		case *ResponseSearch:
+			result.IDs = append(result.IDs, search.IDs...)
+			if search.ModSeq > result.ModSeq {
+				result.ModSeq = search.ModSeq
+			}
+		case *ResponseESearch:
+			ids, err := search.IDs()
+			if err != nil {
+				return nil, err
+			}
+			result.IDs = append(result.IDs, ids...)
+			if search.ModSeq > result.ModSeq {
+				result.ModSeq = search.ModSeq
+			}
+		default:
+			imap.unsolicited(extra)
+		}
+	}
+	return result, nil
+}
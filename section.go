@@ -0,0 +1,187 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FetchSection is the name of a BODY[section], BINARY[section] or
+// BINARY.SIZE[section] fetch item, as in "BODY[1.2.HEADER.FIELDS
+// (FROM TO)]<0>".
+type FetchSection struct {
+	// Name is BODY, BODY.PEEK, BINARY, BINARY.PEEK or BINARY.SIZE.
+	Name string
+
+	// Part is the body part, as in [1 2] for 1.2, or nil for the
+	// whole message.
+	Part []int
+
+	// Specifier is HEADER, HEADER.FIELDS, HEADER.FIELDS.NOT, TEXT,
+	// MIME, or "" for the part's content.  Fields are the header
+	// fields of HEADER.FIELDS and HEADER.FIELDS.NOT, upper-cased.
+	Specifier string
+	Fields    []string
+
+	// Origin is the offset of a partial item, as in <0>, or -1.
+	Origin int
+}
+
+// ParseFetchSection parses the name of a BODY[section] item and the
+// like.
+func ParseFetchSection(key string) (*FetchSection, error) {
+	open := strings.IndexByte(key, '[')
+	close := strings.LastIndexByte(key, ']')
+	if open < 0 || close < open {
+		return nil, fmt.Errorf("imap: bad fetch section %q", key)
+	}
+	sec := &FetchSection{Name: strings.ToUpper(key[:open]), Origin: -1}
+	switch sec.Name {
+	case "BODY", "BODY.PEEK", "BINARY", "BINARY.PEEK", "BINARY.SIZE":
+	default:
+		return nil, fmt.Errorf("imap: bad fetch section %q", key)
+	}
+
+	if partial := key[close+1:]; partial != "" {
+		// "<" number ">"
+		if len(partial) < 3 || partial[0] != '<' || partial[len(partial)-1] != '>' {
+			return nil, fmt.Errorf("imap: bad partial in fetch section %q", key)
+		}
+		n, err := strconv.Atoi(partial[1 : len(partial)-1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("imap: bad partial in fetch section %q", key)
+		}
+		sec.Origin = n
+	}
+
+	// section-part ["." section-text] / section-msgtext
+	spec := key[open+1 : close]
+	for spec != "" && spec[0] >= '0' && spec[0] <= '9' {
+		i := 0
+		for i < len(spec) && spec[i] >= '0' && spec[i] <= '9' {
+			i++
+		}
+		n, err := strconv.Atoi(spec[:i])
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("imap: bad part in fetch section %q", key)
+		}
+		sec.Part = append(sec.Part, n)
+		spec = spec[i:]
+		if spec == "" {
+			break
+		}
+		if spec[0] != '.' || len(spec) == 1 {
+			return nil, fmt.Errorf("imap: bad part in fetch section %q", key)
+		}
+		spec = spec[1:]
+	}
+
+	text, list, hasList := strings.Cut(spec, " ")
+	sec.Specifier = strings.ToUpper(text)
+	switch sec.Specifier {
+	case "":
+	case "HEADER", "TEXT":
+	case "MIME":
+		if sec.Part == nil {
+			return nil, fmt.Errorf("imap: MIME without a part in fetch section %q", key)
+		}
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		if !hasList {
+			return nil, fmt.Errorf("imap: no header list in fetch section %q", key)
+		}
+		p := newParser(strings.NewReader(list))
+		fields, err := p.readParenStringList()
+		if err != nil || len(fields) == 0 || p.Buffered() > 0 {
+			return nil, fmt.Errorf("imap: bad header list in fetch section %q", key)
+		}
+		for _, field := range fields {
+			sec.Fields = append(sec.Fields, strings.ToUpper(field))
+		}
+	default:
+		return nil, fmt.Errorf("imap: bad fetch section %q", key)
+	}
+	if hasList && sec.Fields == nil {
+		return nil, fmt.Errorf("imap: bad fetch section %q", key)
+	}
+	if strings.HasPrefix(sec.Name, "BINARY") && sec.Specifier != "" {
+		return nil, fmt.Errorf("imap: BINARY of %s in fetch section %q", sec.Specifier, key)
+	}
+	return sec, nil
+}
+
+// String returns the item's name in a canonical form, as the keys of
+// ResponseFetch.Body are.
+func (sec *FetchSection) String() string {
+	var b strings.Builder
+	b.WriteString(sec.Name)
+	b.WriteByte('[')
+	for i, n := range sec.Part {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(strconv.Itoa(n))
+	}
+	if sec.Part != nil && sec.Specifier != "" {
+		b.WriteByte('.')
+	}
+	b.WriteString(sec.Specifier)
+	if sec.Fields != nil {
+		b.WriteString(" (")
+		for i, field := range sec.Fields {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(field)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteByte(']')
+	if sec.Origin >= 0 {
+		fmt.Fprintf(&b, "<%d>", sec.Origin)
+	}
+	return b.String()
+}
+
+// readFetchKey reads the name of a fetch item, which for BODY[...]
+// and the like runs to the closing bracket, spaces, quoted header
+// fields and all, and on over a partial's <origin>.
+func (p *parser) readFetchKey() (key string, outErr error) {
+	defer recoverError(&outErr)
+
+	buf := bytes.NewBuffer(make([]byte, 0, 16))
+	inSection := false
+	for {
+		c, err := p.ReadByte()
+		check(err)
+		switch {
+		case c == '\r' || c == '\n':
+			panic(fmt.Errorf("unterminated fetch item %q", buf.String()))
+		case c == '[':
+			inSection = true
+		case c == ']':
+			inSection = false
+		case c == '"' && inSection:
+			// A quoted header field, which may hold ']'; it is
+			// kept as sent, for ParseFetchSection.
+			buf.WriteByte(c)
+			for escaped := false; ; {
+				c, err = p.ReadByte()
+				check(err)
+				if c == '\r' || c == '\n' {
+					panic(fmt.Errorf("unterminated fetch item %q", buf.String()))
+				}
+				buf.WriteByte(c)
+				if c == '"' && !escaped {
+					break
+				}
+				escaped = c == '\\' && !escaped
+			}
+			continue
+		case (c == ' ' || c == ')') && !inSection:
+			check(p.UnreadByte())
+			return buf.String(), nil
+		}
+		buf.WriteByte(c)
+	}
+}
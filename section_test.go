@@ -0,0 +1,88 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseFetchSection(t *testing.T) {
+	tests := []struct {
+		key  string
+		want *FetchSection
+		str  string
+	}{
+		{"BODY[]", &FetchSection{Name: "BODY", Origin: -1}, "BODY[]"},
+		{"body[text]<100>", &FetchSection{Name: "BODY", Specifier: "TEXT", Origin: 100}, "BODY[TEXT]<100>"},
+		{"BODY[1.2.MIME]", &FetchSection{Name: "BODY", Part: []int{1, 2}, Specifier: "MIME", Origin: -1}, "BODY[1.2.MIME]"},
+		{"BODY[3]", &FetchSection{Name: "BODY", Part: []int{3}, Origin: -1}, "BODY[3]"},
+		{
+			`BODY[HEADER.FIELDS (From "X-Odd]")]`,
+			&FetchSection{Name: "BODY", Specifier: "HEADER.FIELDS", Fields: []string{"FROM", "X-ODD]"}, Origin: -1},
+			"BODY[HEADER.FIELDS (FROM X-ODD])]",
+		},
+		{
+			"BODY.PEEK[2.HEADER.FIELDS.NOT (SUBJECT)]<0>",
+			&FetchSection{Name: "BODY.PEEK", Part: []int{2}, Specifier: "HEADER.FIELDS.NOT", Fields: []string{"SUBJECT"}, Origin: 0},
+			"BODY.PEEK[2.HEADER.FIELDS.NOT (SUBJECT)]<0>",
+		},
+		{"BINARY.SIZE[1]", &FetchSection{Name: "BINARY.SIZE", Part: []int{1}, Origin: -1}, "BINARY.SIZE[1]"},
+	}
+	for _, test := range tests {
+		sec, err := ParseFetchSection(test.key)
+		if err != nil {
+			t.Errorf("ParseFetchSection(%q): %s", test.key, err)
+			continue
+		}
+		if !reflect.DeepEqual(sec, test.want) {
+			t.Errorf("ParseFetchSection(%q) = %#v, want %#v", test.key, sec, test.want)
+		}
+		if got := sec.String(); got != test.str {
+			t.Errorf("String of %q = %q, want %q", test.key, got, test.str)
+		}
+	}
+
+	for _, key := range []string{
+		"BODY", "FOO[]", "BODY[MIME]", "BODY[0]", "BODY[1.]", "BODY[HEADER.FIELDS]",
+		"BODY[HEADER.FIELDS ()]", "BODY[TEXT (FROM)]", "BINARY[TEXT]", "BODY[]<>", "BODY[]<x>",
+	} {
+		if sec, err := ParseFetchSection(key); err == nil {
+			t.Errorf("ParseFetchSection(%q) = %#v, want an error", key, sec)
+		}
+	}
+}
+
+func TestReadFetchSections(t *testing.T) {
+	input := "* 1 FETCH (UID 7 BODY[HEADER.FIELDS (FROM \"X-Odd]\")] {9}\r\nFrom: a\r\n BODY[]<0> {3}\r\nabc BODY[HEADER] \"H\")\r\n"
+	r := &reader{newParser(bytes.NewBufferString(input))}
+	_, resp, err := r.readResponse()
+	if err != nil {
+		t.Fatalf("parsing: %s", err)
+	}
+	want := &ResponseFetch{
+		Msg:          1,
+		UID:          7,
+		Rfc822Header: []byte("H"),
+		Body: map[string][]byte{
+			"BODY[HEADER.FIELDS (FROM X-ODD])]": []byte("From: a\r\n"),
+			"BODY[]<0>":                         []byte("abc"),
+			"BODY[HEADER]":                      []byte("H"),
+		},
+	}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %#v, want %#v", resp, want)
+	}
+
+	// A bad response is an error, not a crash.
+	for _, input := range []string{
+		"* 1 FETCH (BODY[HEADER.FIELDS] \"x\")\r\n",
+		"* 1 FETCH (WHATEVER 1)\r\n",
+		"* 1 FETCH (ENVELOPE (NIL))\r\n",
+		"* 1 FETCH (UID)\r\n",
+	} {
+		r := &reader{newParser(bytes.NewBufferString(input))}
+		if _, resp, err := r.readResponse(); err == nil {
+			t.Errorf("parsing %q: got %#v, want an error", input, resp)
+		}
+	}
+}
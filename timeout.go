@@ -0,0 +1,120 @@
+package imap
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrTimeout is the error of a connection that failed because the
+// server took too long; see IMAP's timeout fields.
+var ErrTimeout = errors.New("imap: timeout")
+
+// deadliner is a connection that supports deadlines, like net.Conn.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// started records a command being sent and starts its timers.
+// Called with pendingLock held, before cmd is added to pending.
+func (imap *IMAP) started(cmd *command) {
+	imap.lastActive = time.Now()
+	if cmd.rule.passive {
+		return
+	}
+	if imap.CommandTimeout > 0 {
+		cmd.mu.Lock()
+		cmd.timer = time.AfterFunc(imap.CommandTimeout, func() { imap.timeout(cmd) })
+		cmd.mu.Unlock()
+	}
+	if !imap.awaiting() {
+		// The server's silence counts from now.
+		imap.setReadDeadline()
+	}
+}
+
+// timeout fails the connection because cmd took too long.
+func (imap *IMAP) timeout(cmd *command) {
+	cmd.mu.Lock()
+	done := cmd.done
+	cmd.mu.Unlock()
+	if done {
+		return
+	}
+	imap.fail(ErrTimeout)
+	if imap.closer != nil {
+		// Stop the reader too.
+		imap.closer.Close()
+	}
+}
+
+// awaiting reports whether a command subject to ReadTimeout is
+// pending.  Called with pendingLock held.
+func (imap *IMAP) awaiting() bool {
+	for _, cmd := range imap.pending {
+		if !cmd.rule.passive {
+			return true
+		}
+	}
+	return false
+}
+
+// readDeadline restarts the read deadline after the server has said
+// something, or clears it if no response is awaited.  Called with
+// pendingLock held.
+func (imap *IMAP) readDeadline() {
+	if imap.ReadTimeout <= 0 || imap.conn == nil {
+		return
+	}
+	if imap.awaiting() {
+		imap.setReadDeadline()
+	} else {
+		imap.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func (imap *IMAP) setReadDeadline() {
+	if imap.ReadTimeout > 0 && imap.conn != nil {
+		imap.conn.SetReadDeadline(time.Now().Add(imap.ReadTimeout))
+	}
+}
+
+// writeDeadline sets the deadline for a write.  Called with writeLock
+// held.
+func (imap *IMAP) writeDeadline() {
+	if imap.WriteTimeout > 0 && imap.conn != nil {
+		imap.conn.SetWriteDeadline(time.Now().Add(imap.WriteTimeout))
+	}
+}
+
+// keepAlive sends NOOP whenever the connection has gone KeepAlive
+// without a command in flight, until it fails.
+func (imap *IMAP) keepAlive() {
+	for {
+		imap.pendingLock.Lock()
+		quiet := len(imap.pending) == 0
+		wait := imap.KeepAlive - time.Since(imap.lastActive)
+		imap.pendingLock.Unlock()
+
+		if quiet && wait <= 0 {
+			if imap.Noop() != nil && imap.Err() != nil {
+				return
+			}
+			continue
+		}
+		if wait <= 0 {
+			// Busy; check again later.
+			wait = imap.KeepAlive
+		}
+		select {
+		case <-time.After(wait):
+		case <-imap.dead:
+			return
+		}
+	}
+}
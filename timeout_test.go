@@ -0,0 +1,80 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+// startWith starts a test client after letting configure set it up.
+func startWith(t *testing.T, configure func(*IMAP)) (*IMAP, *testServer) {
+	imap, srv := newTestConn(t)
+	configure(imap)
+	go srv.send("* OK ready")
+	if _, err := imap.Start(); err != nil {
+		t.Fatalf("Start: %s", err)
+	}
+	return imap, srv
+}
+
+func TestKeepAlive(t *testing.T) {
+	imap, srv := startWith(t, func(imap *IMAP) { imap.KeepAlive = 20 * time.Millisecond })
+	srv.expect("a0 NOOP")
+	srv.send("* 3 EXISTS", "a0 OK done")
+	srv.expect("a1 NOOP")
+	srv.send("a1 OK done")
+
+	// Nothing is sent while a command is in flight.
+	done := async(func() error {
+		_, err := imap.Capability()
+		return err
+	})
+	srv.expect("a2 CAPABILITY")
+	time.Sleep(50 * time.Millisecond)
+	srv.send("* CAPABILITY IMAP4rev1", "a2 OK done")
+	if err := wait(t, done); err != nil {
+		t.Fatalf("Capability: %s", err)
+	}
+	srv.expect("a3 NOOP")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	imap, srv := startWith(t, func(imap *IMAP) { imap.CommandTimeout = 20 * time.Millisecond })
+	done := async(func() error {
+		_, err := imap.Capability()
+		return err
+	})
+	srv.expect("a0 CAPABILITY")
+	if err := wait(t, done); err != ErrTimeout {
+		t.Fatalf("Capability: got %v, want ErrTimeout", err)
+	}
+	if err := imap.Noop(); err != ErrTimeout {
+		t.Fatalf("Noop after timeout: got %v, want ErrTimeout", err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	imap, srv := startWith(t, func(imap *IMAP) { imap.ReadTimeout = 20 * time.Millisecond })
+
+	// An idle connection doesn't time out.
+	time.Sleep(50 * time.Millisecond)
+	if err := imap.Err(); err != nil {
+		t.Fatalf("idle connection failed: %s", err)
+	}
+
+	// Data keeps a command alive, silence doesn't.
+	done := async(func() error {
+		_, err := imap.List("", "*")
+		return err
+	})
+	srv.expect(`a0 LIST "" "*"`)
+	for i := 0; i < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		srv.send(`* LIST () "/" "INBOX"`)
+	}
+	if err := wait(t, done); err != ErrTimeout {
+		t.Fatalf("List: got %v, want ErrTimeout", err)
+	}
+	if err := imap.Err(); err != ErrTimeout {
+		t.Fatalf("Err() = %v, want ErrTimeout", err)
+	}
+}
@@ -0,0 +1,170 @@
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SkipChildren is returned by a MailboxTree.Walk function to skip the
+// children of the node it was called with.
+var SkipChildren = errors.New("imap: skip children")
+
+// MailboxNode is a mailbox in a MailboxTree.
+type MailboxNode struct {
+	// Name is the full name, as in "Archive/2024", and Leaf its last
+	// level, "2024".
+	Name, Leaf string
+	Delim      string
+
+	// List is the LIST response for the mailbox.  For a parent the
+	// server didn't list, Synthetic is set and List is made up, with
+	// \Noselect.
+	List      *ResponseList
+	Synthetic bool
+
+	// SpecialUse is the special-use attribute, as from List's
+	// SpecialUse.
+	SpecialUse string
+
+	Parent   *MailboxNode
+	Children []*MailboxNode
+}
+
+// Selectable reports whether the mailbox can be selected.
+func (n *MailboxNode) Selectable() bool {
+	return n.List.Selectable == nil || *n.List.Selectable
+}
+
+// Depth returns the node's level: 0 for a top-level mailbox.
+func (n *MailboxNode) Depth() int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return depth
+}
+
+// MailboxTree is the hierarchy of mailboxes that flat LIST results
+// describe, their names split on their delimiters.
+type MailboxTree struct {
+	// Roots are the top-level mailboxes: INBOX first, then the rest
+	// by name, as are the children of every node.
+	Roots []*MailboxNode
+
+	byName map[string]*MailboxNode
+}
+
+// NewMailboxTree builds the tree of the mailboxes in lists, as
+// returned by List or ListExtended.
+func NewMailboxTree(lists []*ResponseList) *MailboxTree {
+	t := &MailboxTree{byName: make(map[string]*MailboxNode)}
+	for _, list := range lists {
+		if list.Name == "" {
+			// LIST "" "", asking for the delimiter.
+			continue
+		}
+		n := t.node(list.Name, list.Delim)
+		n.List = list
+		n.Synthetic = false
+		n.SpecialUse = list.SpecialUse()
+	}
+	sortNodes(t.Roots)
+	return t
+}
+
+// node returns the node for name, making it and its parents as
+// needed.
+func (t *MailboxTree) node(name, delim string) *MailboxNode {
+	if n := t.Lookup(name); n != nil {
+		return n
+	}
+	var parent *MailboxNode
+	leaf := name
+	if delim != "" {
+		if i := strings.LastIndex(name, delim); i > 0 {
+			parent = t.node(name[:i], delim)
+			leaf = name[i+len(delim):]
+		}
+	}
+	no := false
+	n := &MailboxNode{
+		Name:      name,
+		Leaf:      leaf,
+		Delim:     delim,
+		List:      &ResponseList{Attributes: []string{`\Noselect`}, Selectable: &no, Delim: delim, Name: name},
+		Synthetic: true,
+		Parent:    parent,
+	}
+	if parent != nil {
+		parent.Children = append(parent.Children, n)
+	} else {
+		t.Roots = append(t.Roots, n)
+	}
+	t.byName[treeKey(name)] = n
+	return n
+}
+
+// Lookup returns the node of the mailbox with the given full name,
+// or nil.  INBOX is found in any case.
+func (t *MailboxTree) Lookup(name string) *MailboxNode {
+	return t.byName[treeKey(name)]
+}
+
+// Walk calls f for every node depth-first, parents before their
+// children, in the tree's order.  If f returns SkipChildren, the
+// node's children are skipped; any other error stops the walk and is
+// returned.
+func (t *MailboxTree) Walk(f func(*MailboxNode) error) error {
+	return walkNodes(t.Roots, f)
+}
+
+func walkNodes(nodes []*MailboxNode, f func(*MailboxNode) error) error {
+	for _, n := range nodes {
+		err := f(n)
+		if err == SkipChildren {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := walkNodes(n.Children, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortNodes(nodes []*MailboxNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if ai, bi := isInbox(a), isInbox(b); ai != bi {
+			return ai
+		}
+		return a.Leaf < b.Leaf
+	})
+	for _, n := range nodes {
+		sortNodes(n.Children)
+	}
+}
+
+func isInbox(n *MailboxNode) bool {
+	return n.Parent == nil && strings.EqualFold(n.Name, "INBOX")
+}
+
+// treeKey is the key of a mailbox name: the name, but with INBOX,
+// which is case-insensitive, in upper case, also as the top level of
+// a longer name.
+func treeKey(name string) string {
+	if len(name) < 5 || !strings.EqualFold(name[:5], "INBOX") {
+		return name
+	}
+	if len(name) > 5 {
+		if c := name[5]; c == '_' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) {
+			// "Inboxes", not "Inbox/Receipts".
+			return name
+		}
+	}
+	return "INBOX" + name[5:]
+}
@@ -0,0 +1,58 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMailboxTree(t *testing.T) {
+	yes, no := true, false
+	lists := []*ResponseList{
+		{Delim: "/", Name: ""},
+		{Delim: "/", Name: "Work/Projects/Alpha"},
+		{Attributes: []string{`\Sent`}, Delim: "/", Name: "Sent"},
+		{Delim: "/", Name: "Inbox"},
+		{Attributes: []string{`\Noselect`}, Selectable: &no, Children: &yes, Delim: "/", Name: "Work"},
+		{Delim: "/", Name: "INBOX/Receipts"},
+		{Delim: "/", Name: "Archive"},
+	}
+	tree := NewMailboxTree(lists)
+
+	var walked []string
+	err := tree.Walk(func(n *MailboxNode) error {
+		walked = append(walked, strings.Repeat(" ", n.Depth())+n.Leaf)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %s", err)
+	}
+	if got, want := strings.Join(walked, ","), "Inbox, Receipts,Archive,Sent,Work, Projects,  Alpha"; got != want {
+		t.Errorf("walked %q, want %q", got, want)
+	}
+
+	projects := tree.Lookup("Work/Projects")
+	if projects == nil || !projects.Synthetic || projects.Selectable() || projects.Parent != tree.Lookup("Work") {
+		t.Errorf("Work/Projects: %#v", projects)
+	}
+	if work := tree.Lookup("Work"); work.Synthetic || work.Selectable() || len(work.Children) != 1 {
+		t.Errorf("Work: %#v", work)
+	}
+	if sent := tree.Lookup("Sent"); sent.SpecialUse != SpecialUseSent || !sent.Selectable() {
+		t.Errorf("Sent: %#v", sent)
+	}
+	if tree.Lookup("inbox/Receipts") == nil || tree.Lookup("Nowhere") != nil {
+		t.Errorf("Lookup wrong")
+	}
+
+	walked = nil
+	tree.Walk(func(n *MailboxNode) error {
+		walked = append(walked, n.Name)
+		if n.Name == "Work" {
+			return SkipChildren
+		}
+		return nil
+	})
+	if got, want := strings.Join(walked, ","), "Inbox,INBOX/Receipts,Archive,Sent,Work"; got != want {
+		t.Errorf("walked %q, want %q", got, want)
+	}
+}
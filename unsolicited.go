@@ -0,0 +1,255 @@
+package imap
+
+import "sync"
+
+// Handler receives the server data that isn't a response to any
+// command (see doc.go).
+//
+// Handlers are called one at a time, in the order the data arrived,
+// mostly from the goroutine reading the connection.  They must not
+// block or wait for commands, or nothing more is read; to process
+// data at leisure, read it from Queue, or add a QueueHandler.
+type Handler interface {
+	OnExists(*ResponseExists)
+	OnRecent(*ResponseRecent)
+	OnExpunge(*ResponseExpunge)
+	// OnVanished replaces OnExpunge once QRESYNC is enabled.
+	OnVanished(*ResponseVanished)
+	OnFetch(*ResponseFetch)
+	OnFlags(*ResponseFlags)
+
+	// OnList and OnMailboxStatus are called for mailbox changes
+	// reported under NOTIFY.
+	OnList(*ResponseList)
+	OnMailboxStatus(*ResponseMailboxStatus)
+
+	// OnAlert is called with the text of an [ALERT] response,
+	// which the RFC says must be shown to the user.
+	OnAlert(text string)
+
+	// OnBye is called when the server closes the connection.
+	OnBye(*ResponseBye)
+
+	// OnStatus is called for other untagged OK, NO and BAD
+	// responses.
+	OnStatus(*ResponseStatus)
+
+	// OnOther is called for everything else.
+	OnOther(interface{})
+}
+
+// NopHandler is a Handler that ignores everything.  Embed it in a
+// handler to implement only the methods you need.
+type NopHandler struct{}
+
+func (NopHandler) OnExists(*ResponseExists)               {}
+func (NopHandler) OnRecent(*ResponseRecent)               {}
+func (NopHandler) OnExpunge(*ResponseExpunge)             {}
+func (NopHandler) OnVanished(*ResponseVanished)           {}
+func (NopHandler) OnFetch(*ResponseFetch)                 {}
+func (NopHandler) OnFlags(*ResponseFlags)                 {}
+func (NopHandler) OnList(*ResponseList)                   {}
+func (NopHandler) OnMailboxStatus(*ResponseMailboxStatus) {}
+func (NopHandler) OnAlert(string)                         {}
+func (NopHandler) OnBye(*ResponseBye)                     {}
+func (NopHandler) OnStatus(*ResponseStatus)               {}
+func (NopHandler) OnOther(interface{})                    {}
+
+// handlers is the set of registered handlers.
+type handlers struct {
+	mu   sync.Mutex
+	list []*Handler
+
+	// call serialises the calls themselves, so handlers may be
+	// added or removed from within a handler.
+	call sync.Mutex
+
+	// queue is the default handler, made on first use; see Queue.
+	queue *QueueHandler
+}
+
+// AddHandler registers a handler for unsolicited data and returns a
+// function that removes it again.
+func (imap *IMAP) AddHandler(h Handler) (remove func()) {
+	return imap.handlers.add(h)
+}
+
+// Queue returns the QueueHandler that all unsolicited data goes to,
+// besides any handlers added: one of DefaultQueueSize, dropping the
+// oldest data when full.  Reading it is the way to see such data
+// without holding up the connection.
+func (imap *IMAP) Queue() *QueueHandler {
+	return imap.handlers.defaultQueue()
+}
+
+// unsolicited passes unsolicited data to the handlers.
+func (imap *IMAP) unsolicited(r interface{}) {
+	imap.handlers.handle(r)
+}
+
+// add registers a handler; see AddHandler.
+func (hs *handlers) add(h Handler) (remove func()) {
+	entry := &h
+	hs.mu.Lock()
+	hs.list = append(hs.list, entry)
+	hs.mu.Unlock()
+
+	return func() {
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+		for i, e := range hs.list {
+			if e == entry {
+				hs.list = append(hs.list[:i:i], hs.list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// defaultQueue returns the default handler, making it if need be.
+func (hs *handlers) defaultQueue() *QueueHandler {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.queue == nil {
+		hs.queue = NewQueueHandler(DefaultQueueSize, DropOldest)
+	}
+	return hs.queue
+}
+
+// handle passes data to the default queue and each handler.
+func (hs *handlers) handle(r interface{}) {
+	queue := hs.defaultQueue()
+	hs.mu.Lock()
+	list := hs.list
+	hs.mu.Unlock()
+
+	hs.call.Lock()
+	defer hs.call.Unlock()
+	queue.handle(r)
+	for _, h := range list {
+		callHandler(*h, r)
+	}
+}
+
+// rawHandler is implemented by internal handlers that take the data
+// as it is rather than method by method.
+type rawHandler interface {
+	handle(r interface{})
+}
+
+// alert reports the [ALERT] in a command's status, if any.
+func (imap *IMAP) alert(resp *ResponseStatus) {
+	if resp.Code == "ALERT" {
+		imap.unsolicited(resp)
+	}
+}
+
+func callHandler(h Handler, r interface{}) {
+	if raw, ok := h.(rawHandler); ok {
+		raw.handle(r)
+		return
+	}
+	switch r := r.(type) {
+	case *ResponseExists:
+		h.OnExists(r)
+	case *ResponseRecent:
+		h.OnRecent(r)
+	case *ResponseExpunge:
+		h.OnExpunge(r)
+	case *ResponseVanished:
+		h.OnVanished(r)
+	case *ResponseFetch:
+		h.OnFetch(r)
+	case *ResponseFlags:
+		h.OnFlags(r)
+	case *ResponseList:
+		h.OnList(r)
+	case *ResponseMailboxStatus:
+		h.OnMailboxStatus(r)
+	case *ResponseBye:
+		if r.Code == "ALERT" {
+			h.OnAlert(r.Text)
+		}
+		h.OnBye(r)
+	case *ResponseStatus:
+		if r.Code == "ALERT" {
+			h.OnAlert(r.Text)
+		} else {
+			h.OnStatus(r)
+		}
+	default:
+		h.OnOther(r)
+	}
+}
+
+// OverflowPolicy says what a QueueHandler does when it is full.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest queued item to make room, so
+	// the queue holds the most recent data.
+	DropOldest OverflowPolicy = iota
+	// DropNewest discards the incoming item.
+	DropNewest
+)
+
+// DefaultQueueSize is the QueueHandler size used when none is given.
+const DefaultQueueSize = 256
+
+// QueueHandler is a Handler that queues unsolicited data, as the
+// response values themselves (*ResponseExists, *ResponseFetch, ...),
+// on a bounded channel for the caller to read at its own pace.
+// Alerts arrive as the *ResponseStatus or *ResponseBye carrying them.
+// When the queue is full, data is dropped according to the policy
+// and counted; adding to the queue never blocks.
+type QueueHandler struct {
+	NopHandler
+
+	policy  OverflowPolicy
+	mu      sync.Mutex
+	ch      chan interface{}
+	dropped int
+}
+
+// NewQueueHandler returns a QueueHandler holding up to size items; a
+// size of zero or less means DefaultQueueSize.
+func NewQueueHandler(size int, policy OverflowPolicy) *QueueHandler {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &QueueHandler{policy: policy, ch: make(chan interface{}, size)}
+}
+
+// C returns the channel the data is queued on.
+func (q *QueueHandler) C() <-chan interface{} {
+	return q.ch
+}
+
+// Dropped returns how many items have been dropped so far.
+func (q *QueueHandler) Dropped() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+func (q *QueueHandler) handle(r interface{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		select {
+		case q.ch <- r:
+			return
+		default:
+		}
+		q.dropped++
+		if q.policy == DropNewest {
+			return
+		}
+		select {
+		case <-q.ch:
+		default:
+			// The reader got there first; there's room now.
+			q.dropped--
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recordingHandler struct {
+	NopHandler
+	events chan interface{}
+}
+
+func (h recordingHandler) OnExists(r *ResponseExists) { h.events <- r }
+func (h recordingHandler) OnAlert(text string)        { h.events <- text }
+func (h recordingHandler) OnBye(r *ResponseBye)       { h.events <- r }
+
+func (h recordingHandler) next(t *testing.T) interface{} {
+	t.Helper()
+	select {
+	case e := <-h.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event")
+	}
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	h := recordingHandler{events: make(chan interface{}, 10)}
+	remove := imap.AddHandler(h)
+
+	srv.send("* 23 EXISTS", "* OK [ALERT] Maintenance at noon")
+	if e, ok := h.next(t).(*ResponseExists); !ok || e.Count != 23 {
+		t.Fatalf("got %#v, want EXISTS 23", e)
+	}
+	if e := h.next(t); e != "Maintenance at noon" {
+		t.Fatalf("got %#v, want alert", e)
+	}
+
+	// Nobody's listening now, and that's fine.
+	remove()
+	srv.send("* 24 EXISTS")
+
+	h2 := recordingHandler{events: make(chan interface{}, 10)}
+	imap.AddHandler(h2)
+	srv.send("* BYE going away")
+	for {
+		// h2 may or may not have been added in time for EXISTS 24.
+		e := h2.next(t)
+		if _, ok := e.(*ResponseExists); ok {
+			continue
+		}
+		if bye, ok := e.(*ResponseBye); !ok || bye.Text != "going away" {
+			t.Fatalf("got %#v, want BYE", e)
+		}
+		break
+	}
+	select {
+	case e := <-h.events:
+		t.Fatalf("removed handler got %#v", e)
+	default:
+	}
+}
+
+func TestQueueHandlerOverflow(t *testing.T) {
+	for _, test := range []struct {
+		policy OverflowPolicy
+		want   []int
+	}{
+		{DropOldest, []int{3, 4}},
+		{DropNewest, []int{1, 2}},
+	} {
+		q := NewQueueHandler(2, test.policy)
+		for i := 1; i <= 4; i++ {
+			callHandler(q, &ResponseExists{i})
+		}
+		if q.Dropped() != 2 {
+			t.Errorf("policy %d: dropped %d, want 2", test.policy, q.Dropped())
+		}
+		for _, want := range test.want {
+			if got := (<-q.C()).(*ResponseExists).Count; got != want {
+				t.Errorf("policy %d: got EXISTS %d, want %d", test.policy, got, want)
+			}
+		}
+	}
+}
+
+func TestDefaultQueue(t *testing.T) {
+	imap, srv := newTestClient(t, "* OK ready")
+	srv.send("* 23 EXISTS", "* 1 EXPUNGE")
+	for _, want := range []interface{}{&ResponseExists{23}, &ResponseExpunge{1}} {
+		select {
+		case got := <-imap.Queue().C():
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("nothing queued")
+		}
+	}
+}